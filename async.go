@@ -0,0 +1,35 @@
+package zdpgo_log
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/zhangdapeng520/zdpgo_log/core"
+)
+
+// newAsyncCore 根据配置创建异步写入的core，返回的函数用于停止后台写入
+func newAsyncCore(ccore core.Core, config LogConfig) (core.Core, func()) {
+	opts := []core.AsyncOption{core.AsyncErrorOutput(core.Lock(os.Stderr))}
+	if config.Metrics != nil {
+		opts = append(opts, core.AsyncMetrics(config.Metrics))
+	}
+	if config.AsyncQueueSize > 0 {
+		opts = append(opts, core.AsyncQueueSize(int(config.AsyncQueueSize)))
+	}
+	policy, err := core.ParseOverflowPolicy(config.AsyncOverflow)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to parse log async overflow policy: %v\n", err)
+	}
+	opts = append(opts, core.AsyncOverflow(policy))
+	if policy == core.OverflowDropBelow {
+		dropLevel := InfoLevel
+		if config.AsyncDropLevel != "" {
+			if err := dropLevel.UnmarshalText([]byte(config.AsyncDropLevel)); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to parse log async drop level: %v\n", err)
+				dropLevel = InfoLevel
+			}
+		}
+		opts = append(opts, core.AsyncDropBelow(dropLevel))
+	}
+	return core.NewAsyncCore(ccore, opts...)
+}
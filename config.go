@@ -2,7 +2,9 @@ package zdpgo_log
 
 import (
 	"fmt"
+	"regexp"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/zhangdapeng520/zdpgo_log/core"
@@ -20,6 +22,28 @@ type SamplingConfig struct {
 	Initial    int                                     `json:"initial" yaml:"initial"`
 	Thereafter int                                     `json:"thereafter" yaml:"thereafter"`
 	Hook       func(core.Entry, core.SamplingDecision) `json:"-" yaml:"-"`
+	// Rules override Initial and Thereafter for some loggers or field
+	// values. See core.SamplingRule.
+	Rules []SamplingRuleConfig `json:"rules" yaml:"rules"`
+	// RuleHook is like Hook, but also receives the name of the rule that
+	// made the decision, or "" if no rule matched.
+	RuleHook func(core.Entry, core.SamplingDecision, string) `json:"-" yaml:"-"`
+}
+
+// SamplingRuleConfig describes a rule of SamplingConfig.Rules.
+type SamplingRuleConfig struct {
+	// Name identifies the rule in RuleHook.
+	Name string `json:"name" yaml:"name"`
+	// Names are glob patterns matched against the logger name.
+	Names []string `json:"names" yaml:"names"`
+	// Field makes the rule count each value of that field separately, and
+	// restricts it to entries having the field.
+	Field string `json:"field" yaml:"field"`
+	// Tick is the sampling interval, as understood by time.ParseDuration.
+	// Defaults to one second.
+	Tick       string `json:"tick" yaml:"tick"`
+	Initial    int    `json:"initial" yaml:"initial"`
+	Thereafter int    `json:"thereafter" yaml:"thereafter"`
 }
 
 // Config offers a declarative way to construct a logger. It doesn't do
@@ -71,6 +95,128 @@ type Config struct {
 	ErrorOutputPaths []string `json:"errorOutputPaths" yaml:"errorOutputPaths"`
 	// InitialFields is a collection of fields to add to the root logger.
 	InitialFields map[string]interface{} `json:"initialFields" yaml:"initialFields"`
+	// Routes sends entries matching each route to that route's outputs
+	// instead of OutputPaths. Entries that match no route, or that match a
+	// route with AlsoDefault, are written to OutputPaths. See core.NewRouter
+	// for details.
+	Routes []RouteConfig `json:"routes" yaml:"routes"`
+	// RouteMode is "first" to send an entry to the first matching route only,
+	// or "all" to send it to every matching route. Defaults to "first".
+	RouteMode string `json:"routeMode" yaml:"routeMode"`
+	// Filter drops entries based on their logger name, message and fields.
+	// A nil FilterConfig disables filtering.
+	Filter *FilterConfig `json:"filter" yaml:"filter"`
+	// Redact masks, hashes or drops sensitive data before it's written.
+	// A nil RedactConfig disables redaction.
+	Redact *RedactConfig `json:"redact" yaml:"redact"`
+	// Dedup collapses identical entries into the first occurrence and a
+	// summary. A nil DedupConfig disables it. See core.NewDedupCore.
+	Dedup *DedupConfig `json:"dedup" yaml:"dedup"`
+	// RateLimit caps the bytes and entries written per second. A nil
+	// RateLimitConfig disables it. See core.NewRateLimitCore.
+	RateLimit *RateLimitConfig `json:"rateLimit" yaml:"rateLimit"`
+	// Recorder keeps recent entries below Level in memory and writes them
+	// when an error is logged. A nil RecorderConfig disables it. See
+	// core.NewRecorderCore.
+	Recorder *RecorderConfig `json:"recorder" yaml:"recorder"`
+	// Metrics, if set, counts the entries and bytes written, including those
+	// sent to Routes, along with the sampler's decisions and the entries
+	// dropped by RateLimit and Dedup. Expose it with NewMetricsHandler or
+	// PublishMetrics.
+	Metrics *core.Metrics `json:"-" yaml:"-"`
+	// Metadata adds process and environment fields to every entry. A nil
+	// MetadataConfig adds none.
+	Metadata *MetadataConfig `json:"metadata" yaml:"metadata"`
+}
+
+// RecorderConfig configures the in-memory flight recorder.
+type RecorderConfig struct {
+	// Level is the minimum level of the entries kept. Defaults to "debug".
+	Level string `json:"level" yaml:"level"`
+	// Size is how many entries are kept per scope. Defaults to 100.
+	Size int `json:"size" yaml:"size"`
+	// MaxAge discards entries older than this, as understood by
+	// time.ParseDuration.
+	MaxAge string `json:"maxAge" yaml:"maxAge"`
+	// Trigger is the level at and above which the kept entries are written.
+	// Defaults to "error".
+	Trigger string `json:"trigger" yaml:"trigger"`
+	// ScopeKey keeps a separate buffer for each value of this field, such as
+	// a request ID.
+	ScopeKey string `json:"scopeKey" yaml:"scopeKey"`
+}
+
+// RateLimitConfig configures rate limiting. Zero limits mean unlimited.
+type RateLimitConfig struct {
+	// BytesPerSecond and EntriesPerSecond limit the total of all levels
+	// that aren't in Levels.
+	BytesPerSecond   int `json:"bytesPerSecond" yaml:"bytesPerSecond"`
+	EntriesPerSecond int `json:"entriesPerSecond" yaml:"entriesPerSecond"`
+	// Levels overrides the limits above for some levels, keyed by level
+	// name. Each of these levels is limited separately.
+	Levels map[string]LevelRateLimit `json:"levels" yaml:"levels"`
+	// Bypass is the level at and above which entries are never limited.
+	// Defaults to "error".
+	Bypass string `json:"bypass" yaml:"bypass"`
+	// ReportInterval is how often suppressed entries are reported, as
+	// understood by time.ParseDuration. Defaults to "10s".
+	ReportInterval string `json:"reportInterval" yaml:"reportInterval"`
+}
+
+// LevelRateLimit is the limit of a level in RateLimitConfig.Levels.
+type LevelRateLimit struct {
+	BytesPerSecond   int `json:"bytesPerSecond" yaml:"bytesPerSecond"`
+	EntriesPerSecond int `json:"entriesPerSecond" yaml:"entriesPerSecond"`
+}
+
+// DedupConfig configures duplicate-message suppression.
+type DedupConfig struct {
+	// Window is how long duplicates of an entry are collapsed, as understood
+	// by time.ParseDuration. Defaults to "10s".
+	Window string `json:"window" yaml:"window"`
+	// Keys are the field keys which, along with the level and message, make
+	// two entries identical.
+	Keys []string `json:"keys" yaml:"keys"`
+}
+
+// RedactConfig describes sensitive data, as understood by
+// core.NewRedactCore.
+type RedactConfig struct {
+	// Keys are case-insensitive glob patterns matched against field keys.
+	Keys []string `json:"keys" yaml:"keys"`
+	// Patterns are regular expressions matched against messages and values.
+	Patterns []string `json:"patterns" yaml:"patterns"`
+	// Detectors names built-in detectors: "bank_card", "china_id" and
+	// "china_mobile".
+	Detectors []string `json:"detectors" yaml:"detectors"`
+	// Action is "mask", "hash" or "drop". Defaults to "mask".
+	Action string `json:"action" yaml:"action"`
+}
+
+// FilterConfig holds filter expressions, as understood by core.ParseFilter.
+// An entry is written if it matches Keep (or Keep is empty) and doesn't match
+// Drop.
+type FilterConfig struct {
+	Keep string `json:"keep" yaml:"keep"`
+	Drop string `json:"drop" yaml:"drop"`
+}
+
+// RouteConfig describes a route of Config.Routes. Conditions left empty
+// match every entry; see core.Route.
+type RouteConfig struct {
+	// Level is the minimum level of matching entries.
+	Level string `json:"level" yaml:"level"`
+	// Names are glob patterns matched against the logger name.
+	Names []string `json:"names" yaml:"names"`
+	// Field and Value match entries with a field named Field whose value
+	// matches the glob pattern Value.
+	Field string `json:"field" yaml:"field"`
+	Value string `json:"value" yaml:"value"`
+	// AlsoDefault also writes matching entries to Config.OutputPaths.
+	AlsoDefault bool `json:"alsoDefault" yaml:"alsoDefault"`
+	// OutputPaths is a list of URLs or file paths to write matching entries
+	// to. See Open for details.
+	OutputPaths []string `json:"outputPaths" yaml:"outputPaths"`
 }
 
 // NewProductionEncoderConfig returns an opinionated EncoderConfig for
@@ -165,9 +311,71 @@ func (cfg Config) Build(opts ...Option) (*Logger, error) {
 		return nil, fmt.Errorf("missing Level")
 	}
 
+	// The recorder sits above the other wrappers, so that the entries it
+	// keeps aren't counted, limited or deduplicated until they're flushed.
+	var (
+		level   core.LevelEnabler = cfg.Level
+		capture core.Level
+		recOpts []core.RecorderOption
+	)
+	if rcfg := cfg.Recorder; rcfg != nil {
+		if capture, recOpts, err = rcfg.options(); err != nil {
+			return nil, err
+		}
+		level = withCaptured(cfg.Level, capture)
+	}
+	ccore := core.NewCore(enc, sink, level)
+	if cfg.Metrics != nil {
+		ccore = core.NewMetricsCore(ccore, cfg.Metrics, enc.Clone())
+	}
+	if len(cfg.Routes) > 0 {
+		if ccore, err = cfg.buildRouter(enc, ccore, level); err != nil {
+			return nil, err
+		}
+	}
+	if rcfg := cfg.RateLimit; rcfg != nil {
+		if ccore, err = rcfg.build(ccore, enc, cfg.Metrics); err != nil {
+			return nil, err
+		}
+	}
+	if fcfg := cfg.Filter; fcfg != nil {
+		keep, err := newFilter(fcfg.Keep, fcfg.Drop)
+		if err != nil {
+			return nil, err
+		}
+		if keep != nil {
+			ccore = core.NewFilterCore(ccore, keep)
+		}
+	}
+	if rcfg := cfg.Redact; rcfg != nil {
+		rules, err := rcfg.rules()
+		if err != nil {
+			return nil, err
+		}
+		ccore = core.NewRedactCore(ccore, rules...)
+	}
+	if dcfg := cfg.Dedup; dcfg != nil {
+		if ccore, err = dcfg.build(ccore, cfg.Metrics); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Recorder != nil {
+		ccore = core.NewRecorderCore(ccore, capture, append(recOpts, core.RecorderLevel(cfg.Level))...)
+	}
+	if mcfg := cfg.Metadata; mcfg != nil {
+		ccore = mcfg.wrap(ccore)
+	}
+
+	var rules []core.SamplingRule
+	if scfg := cfg.Sampling; scfg != nil {
+		if rules, err = scfg.rules(); err != nil {
+			return nil, err
+		}
+	}
+
 	log := New(
-		core.NewCore(enc, sink, cfg.Level),
-		cfg.buildOptions(errSink)...,
+		ccore,
+		cfg.buildOptions(errSink, rules)...,
 	)
 	if len(opts) > 0 {
 		log = log.WithOptions(opts...)
@@ -175,7 +383,7 @@ func (cfg Config) Build(opts ...Option) (*Logger, error) {
 	return log, nil
 }
 
-func (cfg Config) buildOptions(errSink core.WriteSyncer) []Option {
+func (cfg Config) buildOptions(errSink core.WriteSyncer, rules []core.SamplingRule) []Option {
 	opts := []Option{ErrorOutput(errSink)}
 
 	if cfg.Development {
@@ -197,8 +405,14 @@ func (cfg Config) buildOptions(errSink core.WriteSyncer) []Option {
 	if scfg := cfg.Sampling; scfg != nil {
 		opts = append(opts, WrapCore(func(ccore core.Core) core.Core {
 			var samplerOpts []core.SamplerOption
-			if scfg.Hook != nil {
-				samplerOpts = append(samplerOpts, core.SamplerHook(scfg.Hook))
+			if hook := cfg.samplerHook(); hook != nil {
+				samplerOpts = append(samplerOpts, core.SamplerHook(hook))
+			}
+			if scfg.RuleHook != nil {
+				samplerOpts = append(samplerOpts, core.SamplerRuleHook(scfg.RuleHook))
+			}
+			if len(rules) > 0 {
+				samplerOpts = append(samplerOpts, core.SamplerRules(rules...))
 			}
 			return core.NewSamplerWithOptions(
 				ccore,
@@ -226,6 +440,22 @@ func (cfg Config) buildOptions(errSink core.WriteSyncer) []Option {
 	return opts
 }
 
+// samplerHook combines SamplingConfig.Hook with the metrics hook.
+func (cfg Config) samplerHook() func(core.Entry, core.SamplingDecision) {
+	hook := cfg.Sampling.Hook
+	if cfg.Metrics == nil {
+		return hook
+	}
+	metricsHook := cfg.Metrics.SamplerHook()
+	if hook == nil {
+		return metricsHook
+	}
+	return func(ent core.Entry, dec core.SamplingDecision) {
+		metricsHook(ent, dec)
+		hook(ent, dec)
+	}
+}
+
 func (cfg Config) openSinks() (core.WriteSyncer, core.WriteSyncer, error) {
 	sink, closeOut, err := Open(cfg.OutputPaths...)
 	if err != nil {
@@ -239,6 +469,237 @@ func (cfg Config) openSinks() (core.WriteSyncer, core.WriteSyncer, error) {
 	return sink, errSink, nil
 }
 
+// buildRouter wraps def in a router for cfg.Routes. The route cores use
+// level, which includes the levels captured by the recorder.
+func (cfg Config) buildRouter(enc core.Encoder, def core.Core, level core.LevelEnabler) (core.Core, error) {
+	mode, err := core.ParseRouteMode(cfg.RouteMode)
+	if err != nil {
+		return nil, err
+	}
+
+	// Close the sinks opened so far if a later route fails.
+	var closers []func()
+	closeAll := func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+
+	routes := make([]core.Route, 0, len(cfg.Routes))
+	for _, rc := range cfg.Routes {
+		route := core.Route{
+			Names:       rc.Names,
+			Field:       rc.Field,
+			Value:       rc.Value,
+			AlsoDefault: rc.AlsoDefault,
+		}
+		if rc.Level != "" {
+			var lvl core.Level
+			if err := lvl.UnmarshalText([]byte(rc.Level)); err != nil {
+				closeAll()
+				return nil, err
+			}
+			route.Level = lvl
+		}
+		sink, closeSink, err := Open(rc.OutputPaths...)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		closers = append(closers, closeSink)
+		route.Core = core.NewCore(enc.Clone(), sink, level)
+		if cfg.Metrics != nil {
+			route.Core = core.NewMetricsCore(route.Core, cfg.Metrics, enc.Clone())
+		}
+		routes = append(routes, route)
+	}
+	return core.NewRouter(routes, def, mode), nil
+}
+
+// newFilter compiles keep and drop expressions into a single predicate. It
+// returns nil if both are empty.
+func newFilter(keep, drop string) (func(core.Entry, []core.Field) bool, error) {
+	var keepFilter, dropFilter *core.Filter
+	var err error
+	if keep != "" {
+		if keepFilter, err = core.ParseFilter(keep); err != nil {
+			return nil, err
+		}
+	}
+	if drop != "" {
+		if dropFilter, err = core.ParseFilter(drop); err != nil {
+			return nil, err
+		}
+	}
+	if keepFilter == nil && dropFilter == nil {
+		return nil, nil
+	}
+	return func(ent core.Entry, fields []core.Field) bool {
+		if keepFilter != nil && !keepFilter.Match(ent, fields) {
+			return false
+		}
+		return dropFilter == nil || !dropFilter.Match(ent, fields)
+	}, nil
+}
+
+var _redactDetectors = map[string]core.RedactDetector{
+	"bank_card":    core.DetectBankCard,
+	"china_id":     core.DetectChinaID,
+	"china_mobile": core.DetectChinaMobile,
+}
+
+// rules converts the RedactConfig into redaction rules sharing its action.
+func (rc RedactConfig) rules() ([]core.RedactRule, error) {
+	action, err := core.ParseRedactAction(rc.Action)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []core.RedactRule
+	if len(rc.Keys) > 0 {
+		rules = append(rules, core.RedactRule{Keys: rc.Keys, Action: action})
+	}
+	for _, pattern := range rc.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, core.RedactRule{Detect: core.RedactPattern(re), Action: action})
+	}
+	for _, name := range rc.Detectors {
+		detect, ok := _redactDetectors[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown redact detector %q", name)
+		}
+		rules = append(rules, core.RedactRule{Detect: detect, Action: action})
+	}
+	return rules, nil
+}
+
+// rules converts the configured sampling rules.
+func (sc SamplingConfig) rules() ([]core.SamplingRule, error) {
+	rules := make([]core.SamplingRule, 0, len(sc.Rules))
+	for _, rc := range sc.Rules {
+		rule := core.SamplingRule{
+			Name:       rc.Name,
+			Names:      rc.Names,
+			Field:      rc.Field,
+			First:      rc.Initial,
+			Thereafter: rc.Thereafter,
+		}
+		if rc.Tick != "" {
+			tick, err := time.ParseDuration(rc.Tick)
+			if err != nil {
+				return nil, fmt.Errorf("sampling rule %q: %v", rc.Name, err)
+			}
+			rule.Tick = tick
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// build wraps c in a rate-limiting Core measuring entries with enc. If m
+// isn't nil, suppressed entries are counted in it.
+func (rc RateLimitConfig) build(c core.Core, enc core.Encoder, m *core.Metrics) (core.Core, error) {
+	var opts []core.RateLimitOption
+	if m != nil {
+		opts = append(opts, core.RateLimitMetrics(m))
+	}
+	for name, l := range rc.Levels {
+		var lvl core.Level
+		if err := lvl.UnmarshalText([]byte(name)); err != nil {
+			return nil, err
+		}
+		opts = append(opts, core.RateLimitLevel(lvl, core.RateLimit{
+			BytesPerSecond:   l.BytesPerSecond,
+			EntriesPerSecond: l.EntriesPerSecond,
+		}))
+	}
+	if rc.Bypass != "" {
+		var lvl core.Level
+		if err := lvl.UnmarshalText([]byte(rc.Bypass)); err != nil {
+			return nil, err
+		}
+		opts = append(opts, core.RateLimitBypass(lvl))
+	}
+	if rc.ReportInterval != "" {
+		d, err := time.ParseDuration(rc.ReportInterval)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, core.RateLimitReportInterval(d))
+	}
+	limit := core.RateLimit{
+		BytesPerSecond:   rc.BytesPerSecond,
+		EntriesPerSecond: rc.EntriesPerSecond,
+	}
+	return core.NewRateLimitCore(c, enc.Clone(), limit, opts...), nil
+}
+
+// options parses the settings, returning the captured level and the
+// options for core.NewRecorderCore.
+func (rc RecorderConfig) options() (core.Level, []core.RecorderOption, error) {
+	capture := core.DebugLevel
+	if rc.Level != "" {
+		if err := capture.UnmarshalText([]byte(rc.Level)); err != nil {
+			return capture, nil, err
+		}
+	}
+	opts := []core.RecorderOption{core.RecorderSize(rc.Size)}
+	if rc.Trigger != "" {
+		var trigger core.Level
+		if err := trigger.UnmarshalText([]byte(rc.Trigger)); err != nil {
+			return capture, nil, err
+		}
+		opts = append(opts, core.RecorderTrigger(trigger))
+	}
+	if rc.MaxAge != "" {
+		d, err := time.ParseDuration(rc.MaxAge)
+		if err != nil {
+			return capture, nil, err
+		}
+		opts = append(opts, core.RecorderMaxAge(d))
+	}
+	if rc.ScopeKey != "" {
+		opts = append(opts, core.RecorderScope(rc.ScopeKey))
+	}
+	return capture, opts, nil
+}
+
+// withCaptured returns the level of the Cores below a flight recorder: they
+// must also enable the captured levels, which the recorder keeps until
+// they're flushed. See core.RecorderLevel.
+func withCaptured(level core.LevelEnabler, capture core.Level) core.LevelEnabler {
+	return LevelEnablerFunc(func(lvl core.Level) bool {
+		return level.Enabled(lvl) || capture.Enabled(lvl)
+	})
+}
+
+const _defaultDedupWindow = 10 * time.Second
+
+// window parses Window, applying the default.
+func (dc DedupConfig) window() (time.Duration, error) {
+	if dc.Window == "" {
+		return _defaultDedupWindow, nil
+	}
+	return time.ParseDuration(dc.Window)
+}
+
+// build wraps c in a deduplicating Core. If m isn't nil, collapsed
+// duplicates are counted in it.
+func (dc DedupConfig) build(c core.Core, m *core.Metrics) (core.Core, error) {
+	window, err := dc.window()
+	if err != nil {
+		return nil, err
+	}
+	opts := []core.DedupOption{core.DedupKeys(dc.Keys...)}
+	if m != nil {
+		opts = append(opts, core.DedupMetrics(m))
+	}
+	return core.NewDedupCore(c, window, opts...), nil
+}
+
 func (cfg Config) buildEncoder() (core.Encoder, error) {
 	return newEncoder(cfg.Encoding, cfg.EncoderConfig)
 }
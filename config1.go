@@ -1,6 +1,13 @@
 package zdpgo_log
 
-import "path"
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/zhangdapeng520/zdpgo_log/core"
+)
 
 // import "path"
 
@@ -16,7 +23,49 @@ type LogConfig struct {
 	MaxSize       uint   `env:"max_size" yaml:"max_size" json:"max_size"`                      // 日志最大保存多少M
 	MaxBackups    uint   `env:"max_backups" yaml:"max_backups" json:"max_backups"`             // 日志保留多少个备份
 	MaxAge        uint   `env:"max_age" yaml:"max_age" json:"max_age"`                         // 最多保留多少天日志
+	MaxLines      uint   `env:"max_lines" yaml:"max_lines" json:"max_lines"`                   // 每个日志文件最多多少行，0表示不限制
 	Compress      bool   `env:"compress" yaml:"compress" json:"compress"`                      // 是否压缩
+	Oversize      string `env:"oversize" yaml:"oversize" json:"oversize"`                      // 单条日志超过MaxSize时的处理策略：reject、allow、truncate、split
+
+	RotateOnStartup bool   `env:"rotate_on_startup" yaml:"rotate_on_startup" json:"rotate_on_startup"` // 进程启动时总是创建新的日志文件
+	WriteHeader     bool   `env:"write_header" yaml:"write_header" json:"write_header"`                // 是否在每个新日志文件开头写入文件头
+	AppVersion      string `env:"app_version" yaml:"app_version" json:"app_version"`                   // 写入文件头的应用版本
+	BackupDir       string `env:"backup_dir" yaml:"backup_dir" json:"backup_dir"`                      // 备份日志存放目录，默认与日志文件相同
+	FsyncPolicy     string `env:"fsync_policy" yaml:"fsync_policy" json:"fsync_policy"`                // 刷盘策略：never、write、bytes、interval
+	FsyncBytes      uint   `env:"fsync_bytes" yaml:"fsync_bytes" json:"fsync_bytes"`                   // bytes策略下每写入多少字节刷盘一次
+	FsyncInterval   string `env:"fsync_interval" yaml:"fsync_interval" json:"fsync_interval"`          // interval策略下的刷盘间隔，例如"1s"
+	FileMode        string `env:"file_mode" yaml:"file_mode" json:"file_mode"`                         // 日志文件权限，八进制，例如"0640"
+	DirMode         string `env:"dir_mode" yaml:"dir_mode" json:"dir_mode"`                            // 日志目录权限，八进制，例如"0750"
+	FileOwner       string `env:"file_owner" yaml:"file_owner" json:"file_owner"`                      // 日志文件所属用户，用户名或uid
+	FileGroup       string `env:"file_group" yaml:"file_group" json:"file_group"`                      // 日志文件所属用户组，组名或gid
+
+	MillConcurrency    uint `env:"mill_concurrency" yaml:"mill_concurrency" json:"mill_concurrency"`                // 同时压缩和删除备份的最大并发数，默认为1
+	MillBytesPerSecond uint `env:"mill_bytes_per_second" yaml:"mill_bytes_per_second" json:"mill_bytes_per_second"` // 压缩和删除备份每秒最多处理的字节数，0表示不限制
+	CompressAfter      uint `env:"compress_after" yaml:"compress_after" json:"compress_after"`                      // 最近的N个备份不压缩
+	Manifest           bool `env:"manifest" yaml:"manifest" json:"manifest"`                                        // 是否维护备份清单，记录每个备份的时间范围和校验和
+
+	Async          bool   `env:"async" yaml:"async" json:"async"`                                  // 是否异步写入日志
+	AsyncQueueSize uint   `env:"async_queue_size" yaml:"async_queue_size" json:"async_queue_size"` // 异步写入队列的长度，默认1024
+	AsyncOverflow  string `env:"async_overflow" yaml:"async_overflow" json:"async_overflow"`       // 队列满时的策略：block、drop_newest、drop_oldest、drop_below
+	AsyncDropLevel string `env:"async_drop_level" yaml:"async_drop_level" json:"async_drop_level"` // drop_below策略下，低于该级别的日志会被丢弃，默认INFO
+
+	FilterKeep string `env:"filter_keep" yaml:"filter_keep" json:"filter_keep"` // 只保留满足该表达式的日志，例如 logger =~ "db.*"
+	FilterDrop string `env:"filter_drop" yaml:"filter_drop" json:"filter_drop"` // 丢弃满足该表达式的日志，例如 path == "/healthz"
+
+	Redact      *RedactConfig `env:"-" yaml:"redact" json:"redact"`                        // 敏感信息脱敏配置，为nil时不脱敏
+	DedupWindow string        `env:"dedup_window" yaml:"dedup_window" json:"dedup_window"` // 相同日志的合并时间窗口，例如"10s"，为空时不合并
+	DedupKeys   []string      `env:"dedup_keys" yaml:"dedup_keys" json:"dedup_keys"`       // 判断日志相同时额外比较的字段
+
+	RateLimitBytes   uint `env:"rate_limit_bytes" yaml:"rate_limit_bytes" json:"rate_limit_bytes"`       // 每秒最多写入多少字节日志，0表示不限制，ERROR及以上级别不受限制
+	RateLimitEntries uint `env:"rate_limit_entries" yaml:"rate_limit_entries" json:"rate_limit_entries"` // 每秒最多写入多少条日志，0表示不限制，ERROR及以上级别不受限制
+
+	RecorderSize    uint   `env:"recorder_size" yaml:"recorder_size" json:"recorder_size"`          // 在内存中保留最近多少条未输出的低级别日志，出错时一并输出，0表示不保留
+	RecorderMaxAge  string `env:"recorder_max_age" yaml:"recorder_max_age" json:"recorder_max_age"` // 保留日志的最长时间，例如"30s"，为空时不限制
+	RecorderTrigger string `env:"recorder_trigger" yaml:"recorder_trigger" json:"recorder_trigger"` // 达到该级别时输出保留的日志，默认ERROR
+	RecorderScope   string `env:"recorder_scope" yaml:"recorder_scope" json:"recorder_scope"`       // 按该字段的值分别保留日志，例如"request_id"
+
+	Metrics  *core.Metrics   `env:"-" yaml:"-" json:"-"`               // 日志量统计，不为nil时统计各级别和名称的日志条数与字节数，以及异步写入、限速和合并重复日志丢弃的条数
+	Metadata *MetadataConfig `env:"-" yaml:"metadata" json:"metadata"` // 自动添加到每条日志的进程和环境信息，例如主机名、进程ID、环境变量
 }
 
 // 获取默认的配置
@@ -24,7 +73,7 @@ func getDefaultConfig(c LogConfig) LogConfig {
 	// 日志路径
 	if c.LogFilePath == "" {
 		// 创建日志文件夹
-		err := createMultiDir("logs/zdpgo")
+		err := createLogDir("logs/zdpgo", c.DirMode)
 		if err != nil {
 			return c
 		}
@@ -34,7 +83,7 @@ func getDefaultConfig(c LogConfig) LogConfig {
 		dirName := path.Dir(c.LogFilePath)
 
 		// 创建日志文件夹
-		err := createMultiDir(dirName)
+		err := createLogDir(dirName, c.DirMode)
 		if err != nil {
 			return c
 		}
@@ -63,3 +112,28 @@ func getDefaultConfig(c LogConfig) LogConfig {
 	// 返回初始化以后的配置
 	return c
 }
+
+// 创建日志文件夹，指定了权限时新建的文件夹不受umask影响
+func createLogDir(dir, mode string) error {
+	exists := isExist(dir)
+	dirMode, parseErr := parseFileMode(mode, os.ModePerm) // 格式错误在getLogWriter中报告
+	if err := createMultiDir(dir, dirMode); err != nil {
+		return err
+	}
+	if !exists && mode != "" && parseErr == nil {
+		return os.Chmod(dir, dirMode)
+	}
+	return nil
+}
+
+// 解析八进制的权限字符串，为空时返回默认值，格式错误时返回默认值和错误
+func parseFileMode(mode string, defaultMode os.FileMode) (os.FileMode, error) {
+	if mode == "" {
+		return defaultMode, nil
+	}
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return defaultMode, fmt.Errorf("invalid file mode %q, expected octal such as \"0640\"", mode)
+	}
+	return os.FileMode(m).Perm(), nil
+}
@@ -0,0 +1,44 @@
+package zdpgo_log
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 开启Recorder时，匹配路由的debug日志也要缓存，并在出错时写入路由的输出
+func TestConfig_RecorderWithRoutes(t *testing.T) {
+	dir := t.TempDir()
+	mainPath := filepath.Join(dir, "main.log")
+	paymentsPath := filepath.Join(dir, "payments.log")
+
+	cfg := NewProductionConfig()
+	cfg.Sampling = nil
+	cfg.OutputPaths = []string{mainPath}
+	cfg.Routes = []RouteConfig{{Names: []string{"payments"}, OutputPaths: []string{paymentsPath}}}
+	cfg.Recorder = &RecorderConfig{Level: "debug"}
+	logger, err := cfg.Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	payments := logger.Named("payments")
+	payments.Debug("charge started")
+	logger.Debug("request received")
+	payments.Error("charge failed")
+	logger.Sync()
+
+	got, err := os.ReadFile(paymentsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(got)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "charge started") || !strings.Contains(lines[1], "charge failed") {
+		t.Errorf("expected the buffered debug entry before the error, got %q", lines)
+	}
+	// 不按字段区分时所有日志共用一个缓存，其他logger的debug日志一并写入各自的输出
+	if got, _ := os.ReadFile(mainPath); !strings.Contains(string(got), "request received") {
+		t.Errorf("expected the buffered debug entry in the main file, got %q", got)
+	}
+}
@@ -0,0 +1,392 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_log/atomic"
+	"github.com/zhangdapeng520/zdpgo_log/multierr"
+)
+
+const (
+	_defaultAsyncQueueSize      = 1024
+	_defaultAsyncReportInterval = 10 * time.Second
+)
+
+// OverflowPolicy decides what an asynchronous Core does with an entry when
+// its queue is full.
+type OverflowPolicy uint8
+
+const (
+	// OverflowBlock makes the caller wait until there is room in the queue.
+	// It's the default policy.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the entry being written.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest queued entry to make room.
+	OverflowDropOldest
+	// OverflowDropBelow drops the entry being written if its level is below
+	// the configured drop level, and blocks otherwise.
+	OverflowDropBelow
+)
+
+// String returns the name of the policy.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropNewest:
+		return "drop_newest"
+	case OverflowDropOldest:
+		return "drop_oldest"
+	case OverflowDropBelow:
+		return "drop_below"
+	}
+	return fmt.Sprintf("OverflowPolicy(%d)", p)
+}
+
+// ParseOverflowPolicy parses the name of an OverflowPolicy. The empty string
+// parses as OverflowBlock.
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	switch strings.ToLower(name) {
+	case "", "block":
+		return OverflowBlock, nil
+	case "drop_newest":
+		return OverflowDropNewest, nil
+	case "drop_oldest":
+		return OverflowDropOldest, nil
+	case "drop_below":
+		return OverflowDropBelow, nil
+	}
+	return OverflowBlock, fmt.Errorf("unknown overflow policy %q", name)
+}
+
+// asyncOptionFunc wraps a func so it satisfies the AsyncOption interface.
+type asyncOptionFunc func(*asyncQueue)
+
+func (f asyncOptionFunc) apply(q *asyncQueue) {
+	f(q)
+}
+
+// AsyncOption configures an asynchronous Core.
+type AsyncOption interface {
+	apply(*asyncQueue)
+}
+
+// AsyncQueueSize sets how many entries may wait to be written. Defaults to
+// 1024.
+func AsyncQueueSize(size int) AsyncOption {
+	return asyncOptionFunc(func(q *asyncQueue) {
+		if size > 0 {
+			q.size = size
+		}
+	})
+}
+
+// AsyncOverflow sets the policy applied when the queue is full.
+func AsyncOverflow(policy OverflowPolicy) AsyncOption {
+	return asyncOptionFunc(func(q *asyncQueue) {
+		q.policy = policy
+	})
+}
+
+// AsyncDropBelow selects OverflowDropBelow: when the queue is full, entries
+// below lvl are dropped while the rest wait for room.
+func AsyncDropBelow(lvl Level) AsyncOption {
+	return asyncOptionFunc(func(q *asyncQueue) {
+		q.policy = OverflowDropBelow
+		q.dropLevel = lvl
+	})
+}
+
+// AsyncReportInterval sets how often the number of dropped entries is
+// reported as a synthetic warning entry. Defaults to 10 seconds.
+func AsyncReportInterval(d time.Duration) AsyncOption {
+	return asyncOptionFunc(func(q *asyncQueue) {
+		if d > 0 {
+			q.reportInterval = d
+		}
+	})
+}
+
+// AsyncErrorOutput sets where errors from the background writer are
+// reported. By default they are discarded.
+func AsyncErrorOutput(ws WriteSyncer) AsyncOption {
+	return asyncOptionFunc(func(q *asyncQueue) {
+		q.errorOutput = ws
+	})
+}
+
+// AsyncClock sets the clock used for drop reports. Defaults to the system
+// clock.
+func AsyncClock(clock Clock) AsyncOption {
+	return asyncOptionFunc(func(q *asyncQueue) {
+		q.clock = clock
+	})
+}
+
+// AsyncMetrics counts dropped entries in m, in addition to the drop reports.
+func AsyncMetrics(m *Metrics) AsyncOption {
+	return asyncOptionFunc(func(q *asyncQueue) {
+		q.metrics = m
+	})
+}
+
+// NewAsyncCore wraps a Core so that entries are written on a background
+// goroutine instead of the caller's. Entries and copies of their fields are
+// placed on a bounded queue; see OverflowPolicy for what happens when it's
+// full. Entries above ErrorLevel (DPanic, Panic and Fatal) are written
+// synchronously after the queue has been drained, since the process may be
+// about to exit.
+//
+// Fields are copied but not deep-copied, so values such as ObjectMarshalers
+// must not be modified after they are logged.
+//
+// Sync drains the queue before syncing the wrapped Core. The returned
+// function drains the queue and stops the background goroutine; after it has
+// been called, entries are written synchronously.
+func NewAsyncCore(core Core, opts ...AsyncOption) (Core, func()) {
+	q := &asyncQueue{
+		root:           core,
+		size:           _defaultAsyncQueueSize,
+		reportInterval: _defaultAsyncReportInterval,
+		clock:          DefaultClock,
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt.apply(q)
+	}
+	q.items = make(chan asyncItem, q.size)
+	go q.run()
+
+	return &asyncCore{Core: core, q: q}, q.close
+}
+
+type asyncItem struct {
+	core   Core
+	ent    Entry
+	fields []Field
+	flush  chan struct{} // set for Sync markers
+}
+
+type asyncQueue struct {
+	root           Core
+	size           int
+	policy         OverflowPolicy
+	dropLevel      Level
+	reportInterval time.Duration
+	errorOutput    WriteSyncer
+	clock          Clock
+	metrics        *Metrics
+
+	items   chan asyncItem
+	dropped atomic.Uint64
+
+	mu       sync.RWMutex // guards stopped
+	stopped  bool
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+type asyncCore struct {
+	Core
+	q *asyncQueue
+}
+
+func (a *asyncCore) With(fields []Field) Core {
+	return &asyncCore{
+		Core: a.Core.With(fields),
+		q:    a.q,
+	}
+}
+
+func (a *asyncCore) Check(ent Entry, ce *CheckedEntry) *CheckedEntry {
+	if a.Enabled(ent.Level) {
+		return ce.AddCore(ent, a)
+	}
+	return ce
+}
+
+func (a *asyncCore) Write(ent Entry, fields []Field) error {
+	if ent.Level > ErrorLevel {
+		a.q.drain()
+		return writeChecked(a.Core, ent, fields)
+	}
+
+	item := asyncItem{
+		core:   a.Core,
+		ent:    ent,
+		fields: append([]Field(nil), fields...),
+	}
+	if !a.q.enqueue(item) {
+		return writeChecked(a.Core, ent, fields)
+	}
+	return nil
+}
+
+func (a *asyncCore) Sync() error {
+	a.q.drain()
+	return a.Core.Sync()
+}
+
+// enqueue adds item to the queue according to the overflow policy. It
+// returns false if the queue has been stopped and the caller should write
+// the entry itself.
+func (q *asyncQueue) enqueue(item asyncItem) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.stopped {
+		return false
+	}
+
+	policy := q.policy
+	if policy == OverflowDropBelow {
+		policy = OverflowBlock
+		if item.ent.Level < q.dropLevel {
+			policy = OverflowDropNewest
+		}
+	}
+
+	switch policy {
+	case OverflowDropNewest:
+		select {
+		case q.items <- item:
+		default:
+			q.drop()
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case q.items <- item:
+				return true
+			default:
+			}
+			select {
+			case old := <-q.items:
+				if old.flush != nil {
+					// Never drop a Sync marker: the writer may still be
+					// writing the entries queued before it. Queue it again
+					// behind the new entry, waiting for room if needed.
+					q.items <- item
+					q.items <- old
+					return true
+				}
+				q.drop()
+			default:
+			}
+		}
+	default:
+		q.items <- item
+	}
+	return true
+}
+
+// drain blocks until every entry queued before the call has been written.
+func (q *asyncQueue) drain() {
+	q.mu.RLock()
+	if q.stopped {
+		q.mu.RUnlock()
+		return
+	}
+	flush := make(chan struct{})
+	q.items <- asyncItem{flush: flush}
+	q.mu.RUnlock()
+	<-flush
+}
+
+// close drains the queue and stops the background goroutine.
+func (q *asyncQueue) close() {
+	q.stopOnce.Do(func() {
+		q.mu.Lock()
+		q.stopped = true
+		q.mu.Unlock()
+		close(q.stop)
+		<-q.done
+	})
+}
+
+func (q *asyncQueue) run() {
+	defer close(q.done)
+	ticker := q.clock.NewTicker(q.reportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case item := <-q.items:
+			q.process(item)
+		case <-ticker.C:
+			q.report()
+		case <-q.stop:
+			for {
+				select {
+				case item := <-q.items:
+					q.process(item)
+				default:
+					q.report()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (q *asyncQueue) process(item asyncItem) {
+	if item.flush != nil {
+		q.report()
+		close(item.flush)
+		return
+	}
+	q.handleError(item.ent, writeChecked(item.core, item.ent, item.fields))
+}
+
+// drop counts a dropped entry.
+func (q *asyncQueue) drop() {
+	q.dropped.Inc()
+	if q.metrics != nil {
+		q.metrics.AddDropped(1)
+	}
+}
+
+// report writes a synthetic entry with the number of entries dropped since
+// the last report.
+func (q *asyncQueue) report() {
+	n := q.dropped.Swap(0)
+	if n == 0 {
+		return
+	}
+	ent := Entry{
+		Level:   WarnLevel,
+		Time:    q.clock.Now(),
+		Message: "asynchronous logger dropped entries",
+	}
+	fields := []Field{{Key: "dropped", Type: Uint64Type, Integer: int64(n)}}
+	q.handleError(ent, writeChecked(q.root, ent, fields))
+}
+
+func (q *asyncQueue) handleError(ent Entry, err error) {
+	if err == nil || q.errorOutput == nil {
+		return
+	}
+	fmt.Fprintf(q.errorOutput, "%v asynchronous write error: %v\n", ent.Time, err)
+	q.errorOutput.Sync()
+}
+
+// writeChecked runs ent through the Check method of core and writes it to
+// every Core that accepts it. It's used by wrappers that decide to write an
+// entry after the original CheckedEntry has been handled.
+func writeChecked(core Core, ent Entry, fields []Field) error {
+	ce := core.Check(ent, nil)
+	if ce == nil {
+		return nil
+	}
+	var err error
+	for i := range ce.cores {
+		err = multierr.Append(err, ce.cores[i].Write(ce.Entry, fields))
+	}
+	putCheckedEntry(ce)
+	return err
+}
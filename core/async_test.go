@@ -0,0 +1,165 @@
+package core
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingWriter holds every write until release is closed, so that tests
+// can fill the queue of an asynchronous Core while its writer is busy.
+type blockingWriter struct {
+	syncBuffer
+	started chan struct{} // closed on the first write
+	release chan struct{}
+	once    sync.Once
+	relOnce sync.Once
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.started) })
+	<-w.release
+	return w.syncBuffer.Write(p)
+}
+
+// Release lets the held write and all later ones through.
+func (w *blockingWriter) Release() {
+	w.relOnce.Do(func() { close(w.release) })
+}
+
+// newTestAsyncCore returns an asynchronous Core with a queue of two entries
+// whose writer is busy writing "0". The writer is released and the Core
+// stopped when the test ends.
+func newTestAsyncCore(t *testing.T, opts ...AsyncOption) (Core, func(), *blockingWriter) {
+	w := newBlockingWriter()
+	enc := NewConsoleEncoder(EncoderConfig{MessageKey: "msg"})
+	opts = append([]AsyncOption{AsyncQueueSize(2), AsyncClock(newManualClock())}, opts...)
+	c, stop := NewAsyncCore(NewCore(enc, AddSync(w), DebugLevel), opts...)
+	writeAt(c, Entry{Level: InfoLevel, Message: "0"})
+	<-w.started
+	t.Cleanup(func() {
+		w.Release()
+		stop()
+	})
+	return c, stop, w
+}
+
+func TestAsyncCoreOverflow(t *testing.T) {
+	const report = `asynchronous logger dropped entries	{"dropped": 2}`
+	tests := []struct {
+		name string
+		opts []AsyncOption
+		want []string
+	}{
+		{"drop newest", []AsyncOption{AsyncOverflow(OverflowDropNewest)}, []string{"0", "1", "2", report, "5"}},
+		{"drop oldest", []AsyncOption{AsyncOverflow(OverflowDropOldest)}, []string{"0", "3", "4", report, "5"}},
+		{"drop below", []AsyncOption{AsyncDropBelow(WarnLevel)}, []string{"0", "1", "2", report, "5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMetrics()
+			c, _, w := newTestAsyncCore(t, append(tt.opts, AsyncMetrics(m))...)
+
+			for _, msg := range []string{"1", "2", "3", "4"} {
+				writeAt(c, Entry{Level: InfoLevel, Message: msg})
+			}
+			w.Release()
+			if err := c.Sync(); err != nil {
+				t.Fatal(err)
+			}
+			// The report is written on Sync; the queue has room again.
+			writeAt(c, Entry{Level: InfoLevel, Message: "5"})
+			c.Sync()
+			if got := w.Lines(); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+			if n := m.Snapshot().Dropped; n != 2 {
+				t.Errorf("expected 2 drops in the metrics, got %d", n)
+			}
+		})
+	}
+}
+
+func TestAsyncCoreBlock(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []AsyncOption
+	}{
+		{"block", nil},
+		{"drop below", []AsyncOption{AsyncDropBelow(WarnLevel)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _, w := newTestAsyncCore(t, tt.opts...)
+
+			writeAt(c, Entry{Level: InfoLevel, Message: "1"})
+			writeAt(c, Entry{Level: InfoLevel, Message: "2"})
+			written := make(chan struct{})
+			go func() {
+				writeAt(c, Entry{Level: WarnLevel, Message: "3"})
+				close(written)
+			}()
+			select {
+			case <-written:
+				t.Fatal("expected the write to wait for room in the queue")
+			case <-time.After(10 * time.Millisecond):
+			}
+			w.Release()
+			<-written
+			c.Sync()
+			if got := strings.Join(w.Lines(), ","); got != "0,1,2,3" {
+				t.Fatalf("expected every entry, got %q", got)
+			}
+		})
+	}
+}
+
+func TestAsyncCoreDropOldestKeepsSync(t *testing.T) {
+	c, _, w := newTestAsyncCore(t, AsyncOverflow(OverflowDropOldest))
+
+	writeAt(c, Entry{Level: InfoLevel, Message: "1"})
+	synced := make(chan struct{})
+	go func() {
+		c.Sync()
+		close(synced)
+	}()
+	// Wait for the Sync marker to be queued behind "1".
+	q := c.(*asyncCore).q
+	for len(q.items) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	writeAt(c, Entry{Level: InfoLevel, Message: "2"}) // drops "1"
+	go writeAt(c, Entry{Level: InfoLevel, Message: "3"})
+
+	select {
+	case <-synced:
+		t.Fatal("Sync returned before the entries queued ahead of it were written")
+	case <-time.After(10 * time.Millisecond):
+	}
+	w.Release()
+	<-synced
+	if got := w.Lines(); got[0] != "0" {
+		t.Fatalf("expected the entry being written before Sync, got %q", got)
+	}
+}
+
+func TestAsyncCoreStop(t *testing.T) {
+	c, stop, w := newTestAsyncCore(t)
+	writeAt(c, Entry{Level: InfoLevel, Message: "1"})
+	w.Release()
+	stop()
+	if got := strings.Join(w.Lines(), ","); got != "0,1" {
+		t.Fatalf("expected stop to drain the queue, got %q", got)
+	}
+
+	// After stop, entries are written synchronously.
+	writeAt(c, Entry{Level: InfoLevel, Message: "2"})
+	if got := strings.Join(w.Lines(), ","); got != "0,1,2" {
+		t.Fatalf("expected a synchronous write after stop, got %q", got)
+	}
+}
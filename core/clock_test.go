@@ -0,0 +1,42 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// manualClock is a Clock whose time only moves when told to, and whose
+// tickers tick when tick is called.
+type manualClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	ticks chan time.Time
+}
+
+func newManualClock() *manualClock {
+	return &manualClock{
+		now:   time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		ticks: make(chan time.Time),
+	}
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) NewTicker(time.Duration) *time.Ticker {
+	return &time.Ticker{C: c.ticks}
+}
+
+func (c *manualClock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// tick delivers a tick to the ticker's reader, blocking until it's received.
+func (c *manualClock) tick() {
+	c.ticks <- c.Now()
+}
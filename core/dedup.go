@@ -0,0 +1,301 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const _defaultDedupMaxKeys = 1024
+
+// dedupOptionFunc wraps a func so it satisfies the DedupOption interface.
+type dedupOptionFunc func(*dedupState)
+
+func (f dedupOptionFunc) apply(s *dedupState) {
+	f(s)
+}
+
+// DedupOption configures a deduplicating Core.
+type DedupOption interface {
+	apply(*dedupState)
+}
+
+// DedupKeys adds field keys to what makes two entries identical. By default,
+// only the level and message are compared.
+func DedupKeys(keys ...string) DedupOption {
+	return dedupOptionFunc(func(s *dedupState) {
+		s.keys = append(s.keys, keys...)
+	})
+}
+
+// DedupClock sets the clock used to time windows and timestamp summary
+// entries. Defaults to the system clock.
+func DedupClock(clock Clock) DedupOption {
+	return dedupOptionFunc(func(s *dedupState) {
+		s.clock = clock
+	})
+}
+
+// DedupMetrics counts collapsed duplicates as dropped in m, in addition to
+// the summaries.
+func DedupMetrics(m *Metrics) DedupOption {
+	return dedupOptionFunc(func(s *dedupState) {
+		s.metrics = m
+	})
+}
+
+// DedupMaxKeys sets how many distinct entries are tracked at once. When
+// it's reached, the window opened first is closed early, writing its summary,
+// to make room. Defaults to 1024.
+func DedupMaxKeys(n int) DedupOption {
+	return dedupOptionFunc(func(s *dedupState) {
+		if n > 0 {
+			s.maxKeys = n
+		}
+	})
+}
+
+// NewDedupCore creates a Core that collapses identical entries written within
+// window of the first occurrence. Entries are identical if they have the same
+// level and message and, for each key given with DedupKeys, the same field
+// value. The first occurrence is written immediately; the duplicates are
+// counted, and when the window closes a summary entry such as
+//
+//	connection refused (repeated 4,213 times in 10s)
+//
+// is written with the same level, the dedup key fields and a "repeated"
+// field holding the count. Sync writes pending summaries early. Entries above
+// ErrorLevel are never collapsed.
+//
+// Windows are closed by a ticker from the clock (see DedupClock), which only
+// runs while some are open, so a summary is written between one and two
+// windows after the first occurrence. At most 1024 distinct entries are
+// tracked; see DedupMaxKeys.
+func NewDedupCore(core Core, window time.Duration, opts ...DedupOption) Core {
+	s := &dedupState{
+		window:  window,
+		maxKeys: _defaultDedupMaxKeys,
+		clock:   DefaultClock,
+		pending: make(map[string]*dedupRecord),
+	}
+	for _, opt := range opts {
+		opt.apply(s)
+	}
+	return &dedupCore{Core: core, s: s}
+}
+
+type dedupState struct {
+	window  time.Duration
+	keys    []string
+	maxKeys int
+	clock   Clock
+	metrics *Metrics
+
+	mu      sync.Mutex
+	pending map[string]*dedupRecord
+	ticking bool // whether run is sweeping pending
+}
+
+type dedupRecord struct {
+	core     Core
+	ent      Entry
+	fields   []Field   // the dedup key fields of the first occurrence
+	start    time.Time // when the window opened
+	repeated uint64
+}
+
+type dedupCore struct {
+	Core
+	s       *dedupState
+	context []Field
+}
+
+func (c *dedupCore) With(fields []Field) Core {
+	return &dedupCore{
+		Core:    c.Core.With(fields),
+		s:       c.s,
+		context: joinFields(c.context, fields),
+	}
+}
+
+func (c *dedupCore) Check(ent Entry, ce *CheckedEntry) *CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *dedupCore) Write(ent Entry, fields []Field) error {
+	if ent.Level > ErrorLevel || c.s.window <= 0 {
+		return writeChecked(c.Core, ent, fields)
+	}
+
+	all := joinFields(c.context, fields)
+	key := c.s.key(ent, all)
+
+	now := c.s.clock.Now()
+	var closed []*dedupRecord
+
+	c.s.mu.Lock()
+	if rec, ok := c.s.pending[key]; ok {
+		if now.Sub(rec.start) < c.s.window {
+			rec.repeated++
+			c.s.mu.Unlock()
+			if c.s.metrics != nil {
+				c.s.metrics.AddDropped(1)
+			}
+			return nil
+		}
+		// The window has closed but hasn't been swept yet.
+		delete(c.s.pending, key)
+		closed = append(closed, rec)
+	}
+	if len(c.s.pending) >= c.s.maxKeys {
+		closed = append(closed, c.s.evictLocked())
+	}
+	rec := &dedupRecord{core: c.Core, ent: ent, start: now}
+	for _, k := range c.s.keys {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if fields[i].Key == k {
+				rec.fields = append(rec.fields, fields[i])
+				break
+			}
+		}
+	}
+	c.s.pending[key] = rec
+	if !c.s.ticking {
+		c.s.ticking = true
+		go c.s.run()
+	}
+	c.s.mu.Unlock()
+
+	for _, rec := range closed {
+		c.s.summarize(rec, rec.repeated)
+	}
+	return writeChecked(c.Core, ent, fields)
+}
+
+func (c *dedupCore) Sync() error {
+	c.s.flush()
+	return c.Core.Sync()
+}
+
+// key identifies entries that are duplicates of each other.
+func (s *dedupState) key(ent Entry, fields []Field) string {
+	var b strings.Builder
+	b.WriteString(ent.Level.String())
+	b.WriteByte(0)
+	b.WriteString(ent.Message)
+	for _, k := range s.keys {
+		b.WriteByte(0)
+		if v, ok := fieldString(fields, k); ok {
+			b.WriteString(v)
+		}
+	}
+	return b.String()
+}
+
+// run closes expired windows on every tick, until none are open.
+func (s *dedupState) run() {
+	ticker := s.clock.NewTicker(s.window)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if !s.sweep(now) {
+			return
+		}
+	}
+}
+
+// sweep closes the windows that have expired by now and writes their
+// summaries. It reports whether any windows are still open; if not, the
+// ticker must stop.
+func (s *dedupState) sweep(now time.Time) bool {
+	var closed []*dedupRecord
+	s.mu.Lock()
+	for key, rec := range s.pending {
+		if now.Sub(rec.start) >= s.window {
+			delete(s.pending, key)
+			closed = append(closed, rec)
+		}
+	}
+	open := len(s.pending) > 0
+	s.ticking = open
+	s.mu.Unlock()
+
+	for _, rec := range closed {
+		s.summarize(rec, rec.repeated)
+	}
+	return open
+}
+
+// evictLocked removes and returns the record whose window opened first.
+func (s *dedupState) evictLocked() *dedupRecord {
+	var oldest string
+	var oldestRec *dedupRecord
+	for key, rec := range s.pending {
+		if oldestRec == nil || rec.start.Before(oldestRec.start) {
+			oldest, oldestRec = key, rec
+		}
+	}
+	delete(s.pending, oldest)
+	return oldestRec
+}
+
+// flush writes the summaries of all pending records and resets their
+// counts, leaving their windows open.
+func (s *dedupState) flush() {
+	type summary struct {
+		rec *dedupRecord
+		n   uint64
+	}
+	var summaries []summary
+
+	s.mu.Lock()
+	for _, rec := range s.pending {
+		if rec.repeated > 0 {
+			summaries = append(summaries, summary{rec, rec.repeated})
+			rec.repeated = 0
+		}
+	}
+	s.mu.Unlock()
+
+	for _, sum := range summaries {
+		s.summarize(sum.rec, sum.n)
+	}
+}
+
+func (s *dedupState) summarize(rec *dedupRecord, n uint64) {
+	if n == 0 {
+		return
+	}
+	ent := rec.ent
+	ent.Time = s.clock.Now()
+	ent.Message = fmt.Sprintf("%s (repeated %s times in %v)", rec.ent.Message, formatCount(n), s.window)
+	ent.Stack = ""
+	fields := make([]Field, 0, len(rec.fields)+1)
+	fields = append(fields, rec.fields...)
+	fields = append(fields, Field{Key: "repeated", Type: Uint64Type, Integer: int64(n)})
+	_ = writeChecked(rec.core, ent, fields)
+}
+
+// formatCount formats n with thousands separators.
+func formatCount(n uint64) string {
+	s := strconv.FormatUint(n, 10)
+	if len(s) <= 3 {
+		return s
+	}
+	var b strings.Builder
+	head := len(s) % 3
+	if head > 0 {
+		b.WriteString(s[:head])
+	}
+	for i := head; i < len(s); i += 3 {
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(s[i : i+3])
+	}
+	return b.String()
+}
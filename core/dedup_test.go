@@ -0,0 +1,114 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for the writes of background goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Split(strings.TrimSuffix(b.buf.String(), "\n"), "\n")
+}
+
+// waitLines waits until buf holds n lines.
+func waitLines(t *testing.T, buf *syncBuffer, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lines := buf.Lines()
+		if len(lines) >= n && lines[0] != "" {
+			return lines
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d lines, got %q", n, lines)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func newTestDedupCore(window time.Duration, opts ...DedupOption) (Core, *syncBuffer) {
+	buf := &syncBuffer{}
+	enc := NewConsoleEncoder(EncoderConfig{MessageKey: "msg"})
+	return NewDedupCore(NewCore(enc, AddSync(buf), DebugLevel), window, opts...), buf
+}
+
+func writeEntry(t *testing.T, c Core, msg string) {
+	t.Helper()
+	if ce := c.Check(Entry{Level: WarnLevel, Message: msg}, nil); ce != nil {
+		ce.Write()
+	}
+}
+
+func TestDedupCoreTicker(t *testing.T) {
+	clock := newManualClock()
+	c, buf := newTestDedupCore(10*time.Second, DedupClock(clock))
+
+	for i := 0; i < 3; i++ {
+		writeEntry(t, c, "connection refused")
+	}
+	clock.Add(5 * time.Second)
+	clock.tick()
+	clock.tick() // received once the previous sweep is done
+	if lines := waitLines(t, buf, 1); len(lines) != 1 {
+		t.Fatalf("summary written before the window closed: %q", lines)
+	}
+
+	clock.Add(5 * time.Second)
+	clock.tick()
+	lines := waitLines(t, buf, 2)
+	if want := "connection refused (repeated 2 times in 10s)"; !strings.Contains(lines[1], want) {
+		t.Fatalf("expected %q, got %q", want, lines[1])
+	}
+}
+
+func TestDedupCoreExpiredOnWrite(t *testing.T) {
+	clock := newManualClock()
+	c, buf := newTestDedupCore(10*time.Second, DedupClock(clock))
+
+	writeEntry(t, c, "connection refused")
+	writeEntry(t, c, "connection refused")
+	clock.Add(10 * time.Second)
+	// The window has closed without a tick; the next occurrence opens a new
+	// one after summarizing the old.
+	writeEntry(t, c, "connection refused")
+	lines := waitLines(t, buf, 3)
+	if !strings.Contains(lines[1], "repeated 1 times") || strings.Contains(lines[2], "repeated") {
+		t.Fatalf("unexpected output %q", lines)
+	}
+}
+
+func TestDedupCoreMaxKeys(t *testing.T) {
+	clock := newManualClock()
+	c, buf := newTestDedupCore(10*time.Second, DedupClock(clock), DedupMaxKeys(2))
+
+	writeEntry(t, c, "a")
+	writeEntry(t, c, "a")
+	clock.Add(time.Second)
+	writeEntry(t, c, "b")
+	clock.Add(time.Second)
+	// Evicts "a", the oldest window.
+	writeEntry(t, c, "c")
+	lines := waitLines(t, buf, 4)
+	want := []string{"a", "b", "a (repeated 1 times in 10s)", "c"}
+	for i, w := range want {
+		if !strings.HasPrefix(lines[i], w) {
+			t.Errorf("line %d: expected %q, got %q", i, w, lines[i])
+		}
+	}
+}
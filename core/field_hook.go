@@ -0,0 +1,230 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/zhangdapeng520/zdpgo_log/atomic"
+)
+
+// A FieldHook is called with each entry logged and its fields, both the ones
+// added with With and the ones passed at the call site, in the form a
+// MapObjectEncoder gives them: errors under their key as strings,
+// ObjectMarshalers as nested maps, and so on.
+type FieldHook func(ent Entry, fields map[string]interface{}) error
+
+// hookOptionFunc wraps a func so it satisfies the HookOption interface.
+type hookOptionFunc func(*fieldHooks)
+
+func (f hookOptionFunc) apply(h *fieldHooks) {
+	f(h)
+}
+
+// HookOption configures a FieldHook registered with RegisterFieldHook.
+type HookOption interface {
+	apply(*fieldHooks)
+}
+
+// HookLevel only runs the hook for entries enabled by enab.
+func HookLevel(enab LevelEnabler) HookOption {
+	return hookOptionFunc(func(h *fieldHooks) {
+		h.level = enab
+	})
+}
+
+// HookAsync runs the hook on a background goroutine, fed by a queue of the
+// given size. Entries arriving while the queue is full are not passed to the
+// hook; their number is reported to the HookErrorOutput.
+func HookAsync(size int) HookOption {
+	return hookOptionFunc(func(h *fieldHooks) {
+		if size <= 0 {
+			size = _defaultAsyncQueueSize
+		}
+		h.queue = make(chan hookItem, size)
+	})
+}
+
+// HookErrorOutput sets where errors and panics from an asynchronous hook are
+// reported. By default they are discarded.
+func HookErrorOutput(ws WriteSyncer) HookOption {
+	return hookOptionFunc(func(h *fieldHooks) {
+		h.errorOutput = ws
+	})
+}
+
+// RegisterFieldHook wraps a Core and runs hook each time a message is
+// logged. Unlike RegisterHooks, the hook sees the entry's fields.
+//
+// Logging isn't affected by the hook: it runs after the wrapped Core has
+// written the entry, and a panic in the hook is recovered and turned into an
+// error. Synchronous hooks report errors like any other write error, through
+// the Logger's ErrorOutput; asynchronous ones report them to HookErrorOutput.
+//
+// The returned function stops the background goroutine of an asynchronous
+// hook after the queued entries have been handled; it does nothing for
+// synchronous hooks. Sync also waits for the queued entries.
+func RegisterFieldHook(core Core, hook FieldHook, opts ...HookOption) (Core, func()) {
+	h := &fieldHooks{
+		hook:  hook,
+		level: DebugLevel,
+		done:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt.apply(h)
+	}
+	if h.queue != nil {
+		go h.run()
+	} else {
+		close(h.done)
+	}
+	return &fieldHooked{Core: core, h: h}, h.close
+}
+
+type hookItem struct {
+	ent    Entry
+	fields map[string]interface{}
+	flush  chan struct{} // set for Sync markers
+}
+
+type fieldHooks struct {
+	hook        FieldHook
+	level       LevelEnabler
+	errorOutput WriteSyncer
+
+	queue   chan hookItem // nil for synchronous hooks
+	dropped atomic.Uint64
+
+	mu       sync.RWMutex // guards stopped
+	stopped  bool
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+type fieldHooked struct {
+	Core
+	h       *fieldHooks
+	context []Field
+}
+
+func (c *fieldHooked) With(fields []Field) Core {
+	return &fieldHooked{
+		Core:    c.Core.With(fields),
+		h:       c.h,
+		context: joinFields(c.context, fields),
+	}
+}
+
+func (c *fieldHooked) Check(ent Entry, ce *CheckedEntry) *CheckedEntry {
+	// As in RegisterHooks, the wrapped Core registers itself first, so the
+	// hook runs after the entry has been written.
+	if downstream := c.Core.Check(ent, ce); downstream != nil {
+		if c.h.level.Enabled(ent.Level) {
+			return downstream.AddCore(ent, c)
+		}
+		return downstream
+	}
+	return ce
+}
+
+func (c *fieldHooked) Write(ent Entry, fields []Field) error {
+	enc := NewMapObjectEncoder()
+	for _, f := range joinFields(c.context, fields) {
+		f.AddTo(enc)
+	}
+	if !c.h.enqueue(hookItem{ent: ent, fields: enc.Fields}) {
+		return c.h.call(ent, enc.Fields)
+	}
+	return nil
+}
+
+func (c *fieldHooked) Sync() error {
+	c.h.drain()
+	return c.Core.Sync()
+}
+
+// call runs the hook, turning a panic into an error.
+func (h *fieldHooks) call(ent Entry, fields map[string]interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("hook panicked: %v", r)
+		}
+	}()
+	return h.hook(ent, fields)
+}
+
+// enqueue queues item for the background goroutine. It returns false if the
+// hook is synchronous or stopped, and the caller should run it itself.
+func (h *fieldHooks) enqueue(item hookItem) bool {
+	if h.queue == nil {
+		return false
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.stopped {
+		return false
+	}
+	select {
+	case h.queue <- item:
+	default:
+		h.dropped.Inc()
+	}
+	return true
+}
+
+// drain blocks until the entries queued before the call have been handled.
+func (h *fieldHooks) drain() {
+	if h.queue == nil {
+		return
+	}
+	h.mu.RLock()
+	if h.stopped {
+		h.mu.RUnlock()
+		return
+	}
+	flush := make(chan struct{})
+	h.queue <- hookItem{flush: flush}
+	h.mu.RUnlock()
+	<-flush
+}
+
+func (h *fieldHooks) close() {
+	h.stopOnce.Do(func() {
+		if h.queue == nil {
+			return
+		}
+		h.mu.Lock()
+		h.stopped = true
+		close(h.queue)
+		h.mu.Unlock()
+		<-h.done
+	})
+}
+
+func (h *fieldHooks) run() {
+	defer close(h.done)
+	for item := range h.queue {
+		if item.flush != nil {
+			h.reportDropped()
+			close(item.flush)
+			continue
+		}
+		if err := h.call(item.ent, item.fields); err != nil {
+			h.report("%v hook error: %v\n", item.ent.Time, err)
+		}
+	}
+	h.reportDropped()
+}
+
+func (h *fieldHooks) reportDropped() {
+	if n := h.dropped.Swap(0); n > 0 {
+		h.report("hook queue full, %d entries not passed to the hook\n", n)
+	}
+}
+
+func (h *fieldHooks) report(format string, args ...interface{}) {
+	if h.errorOutput == nil {
+		return
+	}
+	fmt.Fprintf(h.errorOutput, format, args...)
+	h.errorOutput.Sync()
+}
@@ -0,0 +1,40 @@
+package core
+
+import "fmt"
+
+// fieldValue returns the value of the last field named key, as it would be
+// seen by a MapObjectEncoder, and whether such a field exists.
+func fieldValue(fields []Field, key string) (interface{}, bool) {
+	for i := len(fields) - 1; i >= 0; i-- {
+		if fields[i].Key != key || fields[i].Type == NamespaceType || fields[i].Type == SkipType {
+			continue
+		}
+		enc := NewMapObjectEncoder()
+		fields[i].AddTo(enc)
+		v, ok := enc.Fields[key]
+		return v, ok
+	}
+	return nil, false
+}
+
+// fieldString is like fieldValue, but formats the value as a string.
+func fieldString(fields []Field, key string) (string, bool) {
+	v, ok := fieldValue(fields, key)
+	if !ok {
+		return "", false
+	}
+	if s, isString := v.(string); isString {
+		return s, true
+	}
+	return fmt.Sprint(v), true
+}
+
+// joinFields returns context followed by fields without modifying either.
+func joinFields(context, fields []Field) []Field {
+	if len(context) == 0 {
+		return fields
+	}
+	all := make([]Field, 0, len(context)+len(fields))
+	all = append(all, context...)
+	return append(all, fields...)
+}
@@ -0,0 +1,40 @@
+package core
+
+type filterCore struct {
+	Core
+	keep    func(Entry, []Field) bool
+	context []Field
+}
+
+// NewFilterCore creates a Core that only writes the entries for which keep
+// returns true. Unlike NewIncreaseLevelCore and LevelEnabler, keep sees the
+// whole Entry along with its fields: those added with With, followed by the
+// ones passed at the call site.
+//
+// Since the call-site fields aren't known until the entry is written, keep
+// is evaluated in Write. Use ParseFilter to build keep from an expression.
+func NewFilterCore(core Core, keep func(Entry, []Field) bool) Core {
+	return &filterCore{Core: core, keep: keep}
+}
+
+func (c *filterCore) With(fields []Field) Core {
+	return &filterCore{
+		Core:    c.Core.With(fields),
+		keep:    c.keep,
+		context: joinFields(c.context, fields),
+	}
+}
+
+func (c *filterCore) Check(ent Entry, ce *CheckedEntry) *CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *filterCore) Write(ent Entry, fields []Field) error {
+	if !c.keep(ent, joinFields(c.context, fields)) {
+		return nil
+	}
+	return writeChecked(c.Core, ent, fields)
+}
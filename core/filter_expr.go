@@ -0,0 +1,340 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A Filter is a compiled filter expression. See ParseFilter.
+type Filter struct {
+	expr filterNode
+	src  string
+}
+
+// ParseFilter compiles a small filter expression into a Filter, whose Match
+// method can be passed to NewFilterCore.
+//
+// An expression compares an operand with a value:
+//
+//   path == "/healthz"
+//   logger =~ "db.*"
+//   level >= warn
+//   msg contains timeout
+//
+// The operands level, logger, msg and caller refer to the entry; any other
+// name refers to the field with that key. Prefix a key with "field." if it
+// clashes with one of the entry operands. The operators are ==, !=, =~ and
+// !~ (glob match, as path.Match), contains, and <, <=, >, >= (levels compare
+// by severity, numbers numerically and everything else as strings). Values
+// are bare words or double-quoted strings. An operand on its own is true if
+// the field is present. Comparisons can be combined with &&, || and !, and
+// grouped with parentheses.
+func ParseFilter(expr string) (*Filter, error) {
+	p := &filterParser{src: expr}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("filter %q: unexpected %q", expr, p.tokens[p.pos].text)
+	}
+	return &Filter{expr: node, src: expr}, nil
+}
+
+// Match reports whether the entry and its fields satisfy the expression.
+func (f *Filter) Match(ent Entry, fields []Field) bool {
+	return f.expr.eval(ent, fields)
+}
+
+// String returns the source of the expression.
+func (f *Filter) String() string {
+	return f.src
+}
+
+type filterNode interface {
+	eval(Entry, []Field) bool
+}
+
+type filterAnd struct{ left, right filterNode }
+
+func (n filterAnd) eval(ent Entry, fields []Field) bool {
+	return n.left.eval(ent, fields) && n.right.eval(ent, fields)
+}
+
+type filterOr struct{ left, right filterNode }
+
+func (n filterOr) eval(ent Entry, fields []Field) bool {
+	return n.left.eval(ent, fields) || n.right.eval(ent, fields)
+}
+
+type filterNot struct{ node filterNode }
+
+func (n filterNot) eval(ent Entry, fields []Field) bool {
+	return !n.node.eval(ent, fields)
+}
+
+type filterCompare struct {
+	operand string
+	field   bool // whether operand names a field
+	op      string
+	value   string // empty op means an existence test
+}
+
+func (n filterCompare) lookup(ent Entry, fields []Field) (string, bool) {
+	if n.field {
+		return fieldString(fields, n.operand)
+	}
+	switch n.operand {
+	case "level":
+		return ent.Level.String(), true
+	case "logger":
+		return ent.LoggerName, true
+	case "msg":
+		return ent.Message, true
+	case "caller":
+		if !ent.Caller.Defined {
+			return "", false
+		}
+		return ent.Caller.TrimmedPath(), true
+	}
+	return "", false
+}
+
+func (n filterCompare) eval(ent Entry, fields []Field) bool {
+	v, ok := n.lookup(ent, fields)
+	if n.op == "" {
+		return ok && (n.field || v != "")
+	}
+	if !ok {
+		// A missing field only satisfies negative comparisons.
+		return n.op == "!=" || n.op == "!~"
+	}
+
+	switch n.op {
+	case "==":
+		return v == n.value
+	case "!=":
+		return v != n.value
+	case "=~":
+		matched, _ := path.Match(n.value, v)
+		return matched
+	case "!~":
+		matched, _ := path.Match(n.value, v)
+		return !matched
+	case "contains":
+		return strings.Contains(v, n.value)
+	}
+
+	cmp := n.compare(ent, v)
+	switch n.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// compare orders v against the expression's value.
+func (n filterCompare) compare(ent Entry, v string) int {
+	if !n.field && n.operand == "level" {
+		var want Level
+		if err := want.UnmarshalText([]byte(n.value)); err == nil {
+			return int(ent.Level) - int(want)
+		}
+	}
+	if a, err := strconv.ParseFloat(v, 64); err == nil {
+		if b, err := strconv.ParseFloat(n.value, 64); err == nil {
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(v, n.value)
+}
+
+type filterToken struct {
+	text   string
+	quoted bool
+}
+
+type filterParser struct {
+	src    string
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) tokenize() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')':
+			p.tokens = append(p.tokens, filterToken{text: s[i : i+1]})
+			i++
+		case c == '"':
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(s) {
+				return fmt.Errorf("filter %q: unterminated string", p.src)
+			}
+			text, err := strconv.Unquote(s[i : j+1])
+			if err != nil {
+				return fmt.Errorf("filter %q: %v", p.src, err)
+			}
+			p.tokens = append(p.tokens, filterToken{text: text, quoted: true})
+			i = j + 1
+		case strings.ContainsRune("=!<>&|", rune(c)):
+			j := i + 1
+			if j < len(s) && strings.ContainsRune("=~&|", rune(s[j])) {
+				j++
+			}
+			p.tokens = append(p.tokens, filterToken{text: s[i:j]})
+			i = j
+		default:
+			j := i
+			for j < len(s) && isFilterWordByte(s[j]) {
+				j++
+			}
+			if j == i {
+				return fmt.Errorf("filter %q: unexpected %q", p.src, s[i:i+1])
+			}
+			p.tokens = append(p.tokens, filterToken{text: s[i:j]})
+			i = j
+		}
+	}
+	return nil
+}
+
+func isFilterWordByte(c byte) bool {
+	if c >= 0x80 {
+		return true
+	}
+	r := rune(c)
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.-/*?:[]@", r)
+}
+
+func (p *filterParser) peek() (filterToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return filterToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *filterParser) accept(text string) bool {
+	if tok, ok := p.peek(); ok && !tok.quoted && tok.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = filterOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = filterAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.accept("!") {
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return filterNot{node}, nil
+	}
+	if p.accept("(") {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("filter %q: missing )", p.src)
+		}
+		return node, nil
+	}
+	return p.parseCompare()
+}
+
+var _filterOperators = map[string]bool{
+	"==": true, "!=": true, "=~": true, "!~": true, "contains": true,
+	"<": true, "<=": true, ">": true, ">=": true,
+}
+
+func (p *filterParser) parseCompare() (filterNode, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("filter %q: unexpected end of expression", p.src)
+	}
+	if !tok.quoted && (tok.text == ")" || tok.text == "&&" || tok.text == "||" || _filterOperators[tok.text]) {
+		return nil, fmt.Errorf("filter %q: unexpected %q", p.src, tok.text)
+	}
+	p.pos++
+
+	n := filterCompare{operand: tok.text, field: true}
+	switch {
+	case tok.quoted:
+	case strings.HasPrefix(tok.text, "field."):
+		n.operand = strings.TrimPrefix(tok.text, "field.")
+	case tok.text == "level" || tok.text == "logger" || tok.text == "msg" || tok.text == "caller":
+		n.field = false
+	}
+
+	op, ok := p.peek()
+	if !ok || op.quoted || !_filterOperators[op.text] {
+		return n, nil
+	}
+	p.pos++
+	value, ok := p.peek()
+	if !ok || (!value.quoted && (value.text == "(" || value.text == ")" || value.text == "&&" || value.text == "||")) {
+		return nil, fmt.Errorf("filter %q: missing value after %q", p.src, op.text)
+	}
+	p.pos++
+	n.op = op.text
+	n.value = value.text
+	return n, nil
+}
@@ -0,0 +1,86 @@
+package core
+
+import "testing"
+
+func TestParseFilterMatch(t *testing.T) {
+	ent := Entry{Level: WarnLevel, LoggerName: "db.pool", Message: "query timeout"}
+	fields := []Field{
+		{Key: "path", Type: StringType, String: "/healthz"},
+		{Key: "status", Type: Int64Type, Integer: 200},
+		{Key: "user", Type: StringType, String: "a b"},
+		{Key: "note", Type: StringType, String: `say "hi"`},
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		// Precedence: && binds tighter than ||, ! tighter than both.
+		{`path == "/healthz" || logger == x && status > 500`, true},
+		{`(path == "/healthz" || logger == x) && status > 500`, false},
+		{`!path == "/x" && user`, true},
+		{`!(path == "/healthz" || missing)`, false},
+
+		// Quoting.
+		{`user == "a b"`, true},
+		{`note == "say \"hi\""`, true},
+		{`msg contains "time"`, true},
+		{`"level" == warn`, false},
+		{`field.path == /healthz`, true},
+
+		// Levels compare by severity.
+		{`level >= warn`, true},
+		{`level > warn`, false},
+		{`level < error`, true},
+		{`level == warn`, true},
+
+		// Numbers compare numerically, everything else as strings.
+		{`status > 99`, true},
+		{`status >= 1000`, false},
+		{`status == 200`, true},
+		{`logger < e`, true},
+		{`user >= b`, false},
+
+		// Globs.
+		{`logger =~ "db.*"`, true},
+		{`logger !~ "db.*"`, false},
+		{`path =~ "/health*"`, true},
+
+		// Missing fields and existence tests.
+		{`missing == x`, false},
+		{`missing != x`, true},
+		{`missing !~ "*"`, true},
+		{`path`, true},
+		{`missing`, false},
+		{`!missing`, true},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.expr)
+		if err != nil {
+			t.Errorf("ParseFilter(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := f.Match(ent, fields); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`path ==`,
+		`path == )`,
+		`(path == x`,
+		`path == "x`,
+		`== x`,
+		`path == x)`,
+		`path $ x`,
+		`path == x extra`,
+		`path == x &&`,
+		`user == "\q"`,
+	} {
+		if _, err := ParseFilter(expr); err == nil {
+			t.Errorf("ParseFilter(%q): expected an error", expr)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package core
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/zhangdapeng520/zdpgo_log/atomic"
+)
+
+// Metrics counts the log volume going through one or more metrics Cores.
+// It's safe for concurrent use.
+type Metrics struct {
+	mu      sync.Mutex
+	loggers map[metricsKey]*LoggerMetrics
+
+	dropped atomic.Uint64
+	sampled atomic.Uint64
+	errors  atomic.Uint64
+}
+
+type metricsKey struct {
+	level  Level
+	logger string
+}
+
+// LoggerMetrics holds the counts of a level and logger name.
+type LoggerMetrics struct {
+	Level   Level  `json:"level"`
+	Logger  string `json:"logger"`
+	Entries uint64 `json:"entries"`
+	Bytes   uint64 `json:"bytes"`
+}
+
+// MetricsSnapshot is a copy of the counts of a Metrics.
+type MetricsSnapshot struct {
+	// Loggers are sorted by logger name, then level.
+	Loggers []LoggerMetrics `json:"loggers"`
+	// Dropped counts the entries dropped by the sampler (see SamplerHook)
+	// and by the Cores given m, such as with AsyncMetrics, RateLimitMetrics
+	// or DedupMetrics. Sampled counts the entries the sampler kept.
+	Dropped uint64 `json:"dropped"`
+	Sampled uint64 `json:"sampled"`
+	// Errors counts the writes that failed.
+	Errors uint64 `json:"errors"`
+}
+
+// NewMetrics creates an empty Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{loggers: make(map[metricsKey]*LoggerMetrics)}
+}
+
+// SamplerHook returns a function to pass to the SamplerHook option, so that
+// the sampler's decisions are counted.
+func (m *Metrics) SamplerHook() func(Entry, SamplingDecision) {
+	return func(_ Entry, dec SamplingDecision) {
+		if dec&LogDropped > 0 {
+			m.dropped.Inc()
+		}
+		if dec&LogSampled > 0 {
+			m.sampled.Inc()
+		}
+	}
+}
+
+// AddDropped counts n entries dropped by something other than the sampler,
+// such as a full asynchronous queue.
+func (m *Metrics) AddDropped(n uint64) {
+	m.dropped.Add(n)
+}
+
+// Snapshot returns a copy of the current counts.
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	s := MetricsSnapshot{
+		Dropped: m.dropped.Load(),
+		Sampled: m.sampled.Load(),
+		Errors:  m.errors.Load(),
+	}
+	m.mu.Lock()
+	s.Loggers = make([]LoggerMetrics, 0, len(m.loggers))
+	for _, lm := range m.loggers {
+		s.Loggers = append(s.Loggers, *lm)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(s.Loggers, func(i, j int) bool {
+		if s.Loggers[i].Logger != s.Loggers[j].Logger {
+			return s.Loggers[i].Logger < s.Loggers[j].Logger
+		}
+		return s.Loggers[i].Level < s.Loggers[j].Level
+	})
+	return s
+}
+
+func (m *Metrics) count(ent Entry, bytes int) {
+	key := metricsKey{ent.Level, ent.LoggerName}
+	m.mu.Lock()
+	lm, ok := m.loggers[key]
+	if !ok {
+		lm = &LoggerMetrics{Level: ent.Level, Logger: ent.LoggerName}
+		m.loggers[key] = lm
+	}
+	lm.Entries++
+	lm.Bytes += uint64(bytes)
+	m.mu.Unlock()
+}
+
+type metricsCore struct {
+	Core
+	m   *Metrics
+	enc Encoder
+}
+
+// NewMetricsCore wraps a Core and counts the entries written to it in m, by
+// level and logger name, along with failed writes. If enc isn't nil, entries
+// are also encoded with it to count their size in bytes, so enc should be the
+// encoder used by core.
+func NewMetricsCore(core Core, m *Metrics, enc Encoder) Core {
+	return &metricsCore{Core: core, m: m, enc: enc}
+}
+
+func (c *metricsCore) With(fields []Field) Core {
+	var enc Encoder
+	if c.enc != nil {
+		enc = c.enc.Clone()
+		addFields(enc, fields)
+	}
+	return &metricsCore{
+		Core: c.Core.With(fields),
+		m:    c.m,
+		enc:  enc,
+	}
+}
+
+func (c *metricsCore) Check(ent Entry, ce *CheckedEntry) *CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *metricsCore) Write(ent Entry, fields []Field) error {
+	if err := writeChecked(c.Core, ent, fields); err != nil {
+		c.m.errors.Inc()
+		return err
+	}
+	size := 0
+	if c.enc != nil {
+		if buf, err := c.enc.EncodeEntry(ent, fields); err == nil {
+			size = buf.Len()
+			buf.Free()
+		}
+	}
+	c.m.count(ent, size)
+	return nil
+}
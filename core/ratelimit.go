@@ -0,0 +1,325 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_log/multierr"
+)
+
+const _defaultRateLimitReportInterval = 10 * time.Second
+
+// RateLimit is the rate allowed through a rate-limiting Core. Zero values
+// mean unlimited.
+type RateLimit struct {
+	// BytesPerSecond limits the size of encoded entries.
+	BytesPerSecond int
+	// EntriesPerSecond limits the number of entries.
+	EntriesPerSecond int
+	// BurstBytes and BurstEntries are the bucket capacities, which bound how
+	// much can be written at once after a quiet period. They default to one
+	// second's worth.
+	BurstBytes   int
+	BurstEntries int
+}
+
+// rateLimitOptionFunc wraps a func so it satisfies the RateLimitOption
+// interface.
+type rateLimitOptionFunc func(*rateLimiter)
+
+func (f rateLimitOptionFunc) apply(r *rateLimiter) {
+	f(r)
+}
+
+// RateLimitOption configures a rate-limiting Core.
+type RateLimitOption interface {
+	apply(*rateLimiter)
+}
+
+// RateLimitLevel sets the limit for entries at lvl, replacing the default
+// limit passed to NewRateLimitCore. Entries at lvl then have buckets of their
+// own instead of sharing the default ones.
+func RateLimitLevel(lvl Level, limit RateLimit) RateLimitOption {
+	return rateLimitOptionFunc(func(r *rateLimiter) {
+		if lvl >= _minLevel && lvl <= _maxLevel {
+			r.limits[lvl-_minLevel] = &limit
+		}
+	})
+}
+
+// RateLimitBypass sets the level at and above which entries are never
+// limited. Defaults to ErrorLevel; pass a level above FatalLevel to limit
+// every entry.
+func RateLimitBypass(lvl Level) RateLimitOption {
+	return rateLimitOptionFunc(func(r *rateLimiter) {
+		r.bypass = lvl
+	})
+}
+
+// RateLimitReportInterval sets how often suppressed entries are reported.
+// Defaults to 10 seconds.
+func RateLimitReportInterval(d time.Duration) RateLimitOption {
+	return rateLimitOptionFunc(func(r *rateLimiter) {
+		if d > 0 {
+			r.reportInterval = d
+		}
+	})
+}
+
+// RateLimitClock sets the clock used to refill the buckets and time reports.
+// Defaults to the system clock.
+func RateLimitClock(clock Clock) RateLimitOption {
+	return rateLimitOptionFunc(func(r *rateLimiter) {
+		r.clock = clock
+	})
+}
+
+// RateLimitMetrics counts suppressed entries as dropped in m, in addition to
+// the reports.
+func RateLimitMetrics(m *Metrics) RateLimitOption {
+	return rateLimitOptionFunc(func(r *rateLimiter) {
+		r.metrics = m
+	})
+}
+
+// NewRateLimitCore creates a Core that limits the rate of entries written to
+// the wrapped Core, using token buckets. The default limit is shared by all
+// levels, so it caps their total; levels with a limit of their own (see
+// RateLimitLevel) are counted separately. Each entry is encoded with enc to
+// learn its size, so enc should be the encoder used by core.
+//
+// Entries over the limit are dropped and counted. The counts are written as a
+// warning such as
+//
+//   1,024 entries / 8,388,608 bytes suppressed
+//
+// every report interval, by a ticker from the clock (see RateLimitClock) that
+// only runs while entries are being suppressed, and on Sync. The report
+// itself isn't limited, and neither are entries at or above the bypass level
+// (see RateLimitBypass).
+func NewRateLimitCore(core Core, enc Encoder, limit RateLimit, opts ...RateLimitOption) Core {
+	r := &rateLimiter{
+		root:           core,
+		bypass:         ErrorLevel,
+		reportInterval: _defaultRateLimitReportInterval,
+		clock:          DefaultClock,
+		limit:          limit,
+	}
+	for _, opt := range opts {
+		opt.apply(r)
+	}
+	now := r.clock.Now()
+	shared := newRateBuckets(limit, now)
+	for i, l := range r.limits {
+		if l != nil {
+			r.buckets[i] = newRateBuckets(*l, now)
+		} else {
+			r.buckets[i] = shared
+		}
+	}
+	return &rateLimitCore{Core: core, enc: enc, r: r}
+}
+
+type rateLimiter struct {
+	root           Core
+	limit          RateLimit
+	limits         [_numLevels]*RateLimit // per-level overrides, nil for limit
+	bypass         Level
+	reportInterval time.Duration
+	clock          Clock
+	metrics        *Metrics
+
+	mu      sync.Mutex
+	buckets [_numLevels]*rateBuckets
+	entries uint64 // suppressed since the last report
+	bytes   uint64
+	ticking bool // whether run is reporting
+}
+
+// rateBuckets holds the byte and entry buckets of one or more levels; either
+// may be nil.
+type rateBuckets struct {
+	bytes, entries *tokenBucket
+}
+
+func newRateBuckets(l RateLimit, now time.Time) *rateBuckets {
+	return &rateBuckets{
+		bytes:   newTokenBucket(l.BytesPerSecond, l.BurstBytes, now),
+		entries: newTokenBucket(l.EntriesPerSecond, l.BurstEntries, now),
+	}
+}
+
+type tokenBucket struct {
+	rate, capacity, tokens float64
+	last                   time.Time
+}
+
+func newTokenBucket(rate, burst int, now time.Time) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	return &tokenBucket{
+		rate:     float64(rate),
+		capacity: float64(burst),
+		tokens:   float64(burst),
+		last:     now,
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+		b.last = now
+	}
+}
+
+// allows reports whether n tokens may be taken. An entry larger than the
+// whole bucket is let through when the bucket is full, leaving it in debt.
+func (b *tokenBucket) allows(n float64) bool {
+	return b == nil || b.tokens >= n || b.tokens >= b.capacity
+}
+
+func (b *tokenBucket) take(n float64) {
+	if b != nil {
+		b.tokens -= n
+	}
+}
+
+// allow takes tokens for an entry of size bytes at lvl, reporting whether it
+// may be written.
+func (r *rateLimiter) allow(lvl Level, size int, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b := r.buckets[lvl-_minLevel]
+	if b.bytes != nil {
+		b.bytes.refill(now)
+	}
+	if b.entries != nil {
+		b.entries.refill(now)
+	}
+	if !b.bytes.allows(float64(size)) || !b.entries.allows(1) {
+		r.entries++
+		r.bytes += uint64(size)
+		if r.metrics != nil {
+			r.metrics.AddDropped(1)
+		}
+		if !r.ticking {
+			r.ticking = true
+			go r.run()
+		}
+		return false
+	}
+	b.bytes.take(float64(size))
+	b.entries.take(1)
+	return true
+}
+
+// limited reports whether entries at lvl go through the buckets at all.
+func (r *rateLimiter) limited(lvl Level) bool {
+	if lvl < _minLevel || lvl > _maxLevel || lvl >= r.bypass {
+		return false
+	}
+	l := r.limit
+	if override := r.limits[lvl-_minLevel]; override != nil {
+		l = *override
+	}
+	return l.BytesPerSecond > 0 || l.EntriesPerSecond > 0
+}
+
+// run reports the suppressed counts on every tick, until a tick finds none.
+func (r *rateLimiter) run() {
+	ticker := r.clock.NewTicker(r.reportInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if !r.tick(now) {
+			return
+		}
+	}
+}
+
+// tick writes the report of a tick, reporting whether the ticker must keep
+// running.
+func (r *rateLimiter) tick(now time.Time) bool {
+	r.mu.Lock()
+	if r.entries == 0 {
+		r.ticking = false
+		r.mu.Unlock()
+		return false
+	}
+	r.mu.Unlock()
+	_ = r.report(now)
+	return true
+}
+
+// report writes the counts suppressed since the last report, if any.
+func (r *rateLimiter) report(now time.Time) error {
+	r.mu.Lock()
+	entries, bytes := r.entries, r.bytes
+	r.entries, r.bytes = 0, 0
+	r.mu.Unlock()
+
+	if entries == 0 {
+		return nil
+	}
+	ent := Entry{
+		Level:   WarnLevel,
+		Time:    now,
+		Message: fmt.Sprintf("%s entries / %s bytes suppressed", formatCount(entries), formatCount(bytes)),
+	}
+	fields := []Field{
+		{Key: "suppressed_entries", Type: Uint64Type, Integer: int64(entries)},
+		{Key: "suppressed_bytes", Type: Uint64Type, Integer: int64(bytes)},
+	}
+	return writeChecked(r.root, ent, fields)
+}
+
+type rateLimitCore struct {
+	Core
+	enc Encoder
+	r   *rateLimiter
+}
+
+func (c *rateLimitCore) With(fields []Field) Core {
+	enc := c.enc.Clone()
+	addFields(enc, fields)
+	return &rateLimitCore{
+		Core: c.Core.With(fields),
+		enc:  enc,
+		r:    c.r,
+	}
+}
+
+func (c *rateLimitCore) Check(ent Entry, ce *CheckedEntry) *CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *rateLimitCore) Write(ent Entry, fields []Field) error {
+	if c.r.limited(ent.Level) {
+		buf, err := c.enc.EncodeEntry(ent, fields)
+		if err != nil {
+			return err
+		}
+		size := buf.Len()
+		buf.Free()
+		if !c.r.allow(ent.Level, size, c.r.clock.Now()) {
+			return nil
+		}
+	}
+
+	return writeChecked(c.Core, ent, fields)
+}
+
+func (c *rateLimitCore) Sync() error {
+	return multierr.Append(c.r.report(c.r.clock.Now()), c.Core.Sync())
+}
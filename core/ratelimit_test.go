@@ -0,0 +1,54 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimitCoreTickerReport(t *testing.T) {
+	clock := newManualClock()
+	buf := &syncBuffer{}
+	enc := NewConsoleEncoder(EncoderConfig{MessageKey: "msg"})
+	c := NewRateLimitCore(NewCore(enc, AddSync(buf), DebugLevel), enc, RateLimit{EntriesPerSecond: 1}, RateLimitClock(clock))
+
+	for i := 0; i < 3; i++ {
+		writeEntry(t, c, "busy")
+	}
+	clock.Add(10 * time.Second)
+	clock.tick()
+	lines := waitLines(t, buf, 2)
+	if !strings.HasPrefix(lines[1], "2 entries / ") || !strings.Contains(lines[1], "bytes suppressed") {
+		t.Fatalf("expected a report of 2 entries, got %q", lines)
+	}
+
+	// Nothing was suppressed since; the ticker stops and a new one starts
+	// with the next suppressed entry.
+	clock.tick()
+	writeEntry(t, c, "busy")
+	writeEntry(t, c, "busy")
+	clock.tick()
+	lines = waitLines(t, buf, 4)
+	if !strings.HasPrefix(lines[3], "1 entries / ") {
+		t.Fatalf("expected a report of 1 entry, got %q", lines)
+	}
+}
+
+func TestRateLimitCoreSharedBuckets(t *testing.T) {
+	clock := newManualClock()
+	buf := &syncBuffer{}
+	enc := NewConsoleEncoder(EncoderConfig{MessageKey: "msg"})
+	c := NewRateLimitCore(NewCore(enc, AddSync(buf), DebugLevel), enc, RateLimit{EntriesPerSecond: 2},
+		RateLimitLevel(WarnLevel, RateLimit{EntriesPerSecond: 1}), RateLimitClock(clock))
+
+	// Debug and info share the default limit; warn has its own.
+	for _, lvl := range []Level{DebugLevel, InfoLevel, InfoLevel, DebugLevel, WarnLevel, WarnLevel, ErrorLevel} {
+		if ce := c.Check(Entry{Level: lvl, Message: lvl.String()}, nil); ce != nil {
+			ce.Write()
+		}
+	}
+	want := []string{"debug", "info", "warn", "error"}
+	if got := buf.Lines(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
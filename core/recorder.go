@@ -0,0 +1,290 @@
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_log/multierr"
+)
+
+const (
+	_defaultRecorderSize      = 100
+	_defaultRecorderMaxScopes = 1024
+)
+
+// recorderOptionFunc wraps a func so it satisfies the RecorderOption
+// interface.
+type recorderOptionFunc func(*recorder)
+
+func (f recorderOptionFunc) apply(r *recorder) {
+	f(r)
+}
+
+// RecorderOption configures a flight recorder Core.
+type RecorderOption interface {
+	apply(*recorder)
+}
+
+// RecorderSize sets how many entries are kept per buffer. Defaults to 100.
+func RecorderSize(n int) RecorderOption {
+	return recorderOptionFunc(func(r *recorder) {
+		if n > 0 {
+			r.size = n
+		}
+	})
+}
+
+// RecorderMaxAge discards buffered entries older than d. By default,
+// entries are only discarded when the buffer is full.
+func RecorderMaxAge(d time.Duration) RecorderOption {
+	return recorderOptionFunc(func(r *recorder) {
+		r.maxAge = d
+	})
+}
+
+// RecorderTrigger sets the level at and above which buffered entries are
+// flushed. Defaults to ErrorLevel.
+func RecorderTrigger(lvl Level) RecorderOption {
+	return recorderOptionFunc(func(r *recorder) {
+		r.trigger = lvl
+	})
+}
+
+// RecorderScope keeps a separate buffer for each value of the field named
+// key, typically a request ID added with With. A triggering entry then only
+// flushes the entries sharing its value. Entries without the field share a
+// buffer of their own. At most 1024 scopes are kept; the least recently
+// written one is discarded to make room.
+func RecorderScope(key string) RecorderOption {
+	return recorderOptionFunc(func(r *recorder) {
+		r.scopeKey = key
+	})
+}
+
+// RecorderClock sets the clock used to expire buffered entries. Defaults to
+// the system clock.
+func RecorderClock(clock Clock) RecorderOption {
+	return recorderOptionFunc(func(r *recorder) {
+		r.clock = clock
+	})
+}
+
+// RecorderLevel sets the level of entries written right away; the others
+// that capture enables are buffered. By default, it's the wrapped Core's own
+// level.
+//
+// With a level of its own, the recorder can wrap Cores that only write
+// entries they enable themselves, such as rate limiters or deduplicating
+// Cores. The wrapped Core must then enable the captured levels too; buffered
+// entries don't reach it until they're flushed, so they're neither counted
+// nor limited before that.
+func RecorderLevel(enab LevelEnabler) RecorderOption {
+	return recorderOptionFunc(func(r *recorder) {
+		r.level = enab
+	})
+}
+
+// NewRecorderCore wraps a Core with a flight recorder. Entries that the
+// wrapped Core doesn't enable but capture does, usually debug entries in
+// production, are kept in a ring buffer instead of being dropped. When an
+// entry at or above the trigger level is written, the buffered entries are
+// written first, oldest first, so that the error comes with the context that
+// led to it.
+//
+// Buffered entries are passed directly to the wrapped Core's Write method,
+// bypassing its level check, so core should write whatever it's given, as
+// the Cores returned by NewCore do, unless RecorderLevel is used.
+func NewRecorderCore(core Core, capture LevelEnabler, opts ...RecorderOption) Core {
+	r := &recorder{
+		size:      _defaultRecorderSize,
+		trigger:   ErrorLevel,
+		maxScopes: _defaultRecorderMaxScopes,
+		clock:     DefaultClock,
+		buffers:   make(map[string]*recordRing),
+	}
+	for _, opt := range opts {
+		opt.apply(r)
+	}
+	return &recorderCore{Core: core, capture: capture, r: r}
+}
+
+type recorder struct {
+	level     LevelEnabler
+	size      int
+	maxAge    time.Duration
+	trigger   Level
+	scopeKey  string
+	maxScopes int
+	clock     Clock
+
+	mu      sync.Mutex
+	buffers map[string]*recordRing
+}
+
+type recorded struct {
+	core   Core
+	ent    Entry
+	fields []Field
+}
+
+// recordRing is a fixed-size ring of recorded entries.
+type recordRing struct {
+	items     []recorded
+	start, n  int
+	lastWrite time.Time
+}
+
+func (b *recordRing) push(rec recorded) {
+	if b.n < len(b.items) {
+		b.items[(b.start+b.n)%len(b.items)] = rec
+		b.n++
+		return
+	}
+	b.items[b.start] = rec
+	b.start = (b.start + 1) % len(b.items)
+}
+
+// drain returns the buffered entries, oldest first, and empties the ring.
+func (b *recordRing) drain() []recorded {
+	out := make([]recorded, 0, b.n)
+	for i := 0; i < b.n; i++ {
+		out = append(out, b.items[(b.start+i)%len(b.items)])
+	}
+	b.start, b.n = 0, 0
+	return out
+}
+
+// record adds an entry to the buffer of its scope.
+func (r *recorder) record(scope string, rec recorded) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.buffers[scope]
+	if !ok {
+		if len(r.buffers) >= r.maxScopes {
+			r.evictLocked()
+		}
+		b = &recordRing{items: make([]recorded, r.size)}
+		r.buffers[scope] = b
+	}
+	b.lastWrite = rec.ent.Time
+	b.push(rec)
+}
+
+// evictLocked discards the least recently written buffer.
+func (r *recorder) evictLocked() {
+	var oldest string
+	var oldestTime time.Time
+	first := true
+	for scope, b := range r.buffers {
+		if first || b.lastWrite.Before(oldestTime) {
+			oldest, oldestTime, first = scope, b.lastWrite, false
+		}
+	}
+	delete(r.buffers, oldest)
+}
+
+// take removes and returns the buffered entries of a scope that haven't
+// expired.
+func (r *recorder) take(scope string) []recorded {
+	r.mu.Lock()
+	b, ok := r.buffers[scope]
+	if ok {
+		delete(r.buffers, scope)
+	}
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	recs := b.drain()
+	if r.maxAge <= 0 {
+		return recs
+	}
+	cutoff := r.clock.Now().Add(-r.maxAge)
+	i := 0
+	for i < len(recs) && recs[i].ent.Time.Before(cutoff) {
+		i++
+	}
+	return recs[i:]
+}
+
+type recorderCore struct {
+	Core
+	capture LevelEnabler
+	r       *recorder
+	context []Field // only tracked when scoped
+}
+
+func (c *recorderCore) Enabled(lvl Level) bool {
+	return c.writes(lvl) || c.capture.Enabled(lvl)
+}
+
+// writes reports whether entries at lvl are written right away.
+func (c *recorderCore) writes(lvl Level) bool {
+	if c.r.level != nil {
+		return c.r.level.Enabled(lvl)
+	}
+	return c.Core.Enabled(lvl)
+}
+
+func (c *recorderCore) With(fields []Field) Core {
+	clone := &recorderCore{
+		Core:    c.Core.With(fields),
+		capture: c.capture,
+		r:       c.r,
+	}
+	if c.r.scopeKey != "" {
+		clone.context = joinFields(c.context, fields)
+	}
+	return clone
+}
+
+func (c *recorderCore) Check(ent Entry, ce *CheckedEntry) *CheckedEntry {
+	if !c.writes(ent.Level) {
+		if c.capture.Enabled(ent.Level) {
+			return ce.AddCore(ent, c)
+		}
+		return ce
+	}
+	if ent.Level >= c.r.trigger {
+		// Added before the wrapped Core, so the buffered entries are written
+		// ahead of the triggering one.
+		ce = ce.AddCore(ent, recorderFlusher{c})
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// Write buffers an entry that isn't written right away.
+func (c *recorderCore) Write(ent Entry, fields []Field) error {
+	if c.writes(ent.Level) {
+		return c.Core.Write(ent, fields)
+	}
+	c.r.record(c.scope(fields), recorded{
+		core:   c.Core,
+		ent:    ent,
+		fields: append([]Field(nil), fields...),
+	})
+	return nil
+}
+
+func (c *recorderCore) scope(fields []Field) string {
+	if c.r.scopeKey == "" {
+		return ""
+	}
+	s, _ := fieldString(joinFields(c.context, fields), c.r.scopeKey)
+	return s
+}
+
+// recorderFlusher writes the buffered entries of a triggering entry's scope.
+type recorderFlusher struct {
+	*recorderCore
+}
+
+func (f recorderFlusher) Write(ent Entry, fields []Field) error {
+	var err error
+	for _, rec := range f.r.take(f.scope(fields)) {
+		err = multierr.Append(err, rec.core.Write(rec.ent, rec.fields))
+	}
+	return err
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRecorderCore(opts ...RecorderOption) (Core, *bytes.Buffer) {
+	var buf bytes.Buffer
+	enc := NewConsoleEncoder(EncoderConfig{MessageKey: "msg"})
+	return NewRecorderCore(NewCore(enc, AddSync(&buf), InfoLevel), DebugLevel, opts...), &buf
+}
+
+func writeAt(c Core, ent Entry, fields ...Field) {
+	if ce := c.Check(ent, nil); ce != nil {
+		ce.Write(fields...)
+	}
+}
+
+func outputLines(buf *bytes.Buffer) []string {
+	if buf.Len() == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func TestRecorderCoreFlush(t *testing.T) {
+	c, buf := newTestRecorderCore(RecorderSize(2))
+	if !c.Enabled(DebugLevel) {
+		t.Fatal("expected captured levels to be enabled")
+	}
+
+	for _, msg := range []string{"one", "two", "three"} {
+		writeAt(c, Entry{Level: DebugLevel, Message: msg})
+	}
+	writeAt(c, Entry{Level: InfoLevel, Message: "info"})
+	if got := outputLines(buf); len(got) != 1 || got[0] != "info" {
+		t.Fatalf("expected only the info entry before the trigger, got %q", got)
+	}
+
+	// The ring keeps the two most recent entries, written ahead of the error.
+	writeAt(c, Entry{Level: ErrorLevel, Message: "boom"})
+	want := []string{"info", "two", "three", "boom"}
+	if got := outputLines(buf); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	// The buffer was emptied by the flush.
+	writeAt(c, Entry{Level: ErrorLevel, Message: "again"})
+	if got := outputLines(buf); len(got) != 5 {
+		t.Fatalf("expected no more buffered entries, got %q", got)
+	}
+}
+
+func TestRecorderCoreScope(t *testing.T) {
+	c, buf := newTestRecorderCore(RecorderScope("request"))
+	a := c.With([]Field{{Key: "request", Type: StringType, String: "a"}})
+	b := c.With([]Field{{Key: "request", Type: StringType, String: "b"}})
+
+	writeAt(a, Entry{Level: DebugLevel, Message: "a debug"})
+	writeAt(b, Entry{Level: DebugLevel, Message: "b debug"})
+	writeAt(a, Entry{Level: ErrorLevel, Message: "a error"})
+	if got := buf.String(); !strings.Contains(got, "a debug") || strings.Contains(got, "b debug") {
+		t.Fatalf("expected only the scope's entries to be flushed, got %q", got)
+	}
+
+	// A call-site field selects the scope too.
+	writeAt(c, Entry{Level: ErrorLevel, Message: "b error"}, Field{Key: "request", Type: StringType, String: "b"})
+	if got := buf.String(); !strings.Contains(got, "b debug") {
+		t.Fatalf("expected the other scope to be flushed, got %q", got)
+	}
+}
+
+func TestRecorderCoreMaxAge(t *testing.T) {
+	clock := newManualClock()
+	c, buf := newTestRecorderCore(RecorderMaxAge(time.Minute), RecorderClock(clock))
+
+	writeAt(c, Entry{Level: DebugLevel, Message: "old", Time: clock.Now()})
+	clock.Add(2 * time.Minute)
+	writeAt(c, Entry{Level: DebugLevel, Message: "recent", Time: clock.Now()})
+	writeAt(c, Entry{Level: ErrorLevel, Message: "boom", Time: clock.Now()})
+	want := []string{"recent", "boom"}
+	if got := outputLines(buf); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestRecorderCoreLevel(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewConsoleEncoder(EncoderConfig{MessageKey: "msg"})
+	// The wrapped Core enables debug entries too, as it must with
+	// RecorderLevel; the recorder still buffers them.
+	c := NewRecorderCore(NewCore(enc, AddSync(&buf), DebugLevel), DebugLevel, RecorderLevel(InfoLevel))
+
+	writeAt(c, Entry{Level: DebugLevel, Message: "debug"})
+	if buf.Len() != 0 {
+		t.Fatalf("expected the debug entry to be buffered, got %q", buf.String())
+	}
+	writeAt(c, Entry{Level: WarnLevel, Message: "warn"})
+	writeAt(c, Entry{Level: ErrorLevel, Message: "boom"})
+	want := []string{"warn", "debug", "boom"}
+	if got := outputLines(&buf); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
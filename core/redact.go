@@ -0,0 +1,402 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	_redactedMask = "******"
+	_redactedText = "[REDACTED]"
+)
+
+// RedactAction is what a redaction rule does with sensitive data.
+type RedactAction uint8
+
+const (
+	// RedactMask replaces sensitive data with asterisks. Detected substrings
+	// keep their first three and last four characters when long enough.
+	RedactMask RedactAction = iota
+	// RedactHash replaces sensitive data with a prefix of its SHA-256, so
+	// that equal values can still be correlated.
+	RedactHash
+	// RedactDrop removes the field. Inside a message, the sensitive
+	// substring is replaced with "[REDACTED]".
+	RedactDrop
+)
+
+// ParseRedactAction parses "mask", "hash" or "drop". The empty string parses
+// as RedactMask.
+func ParseRedactAction(name string) (RedactAction, error) {
+	switch strings.ToLower(name) {
+	case "", "mask":
+		return RedactMask, nil
+	case "hash":
+		return RedactHash, nil
+	case "drop":
+		return RedactDrop, nil
+	}
+	return RedactMask, fmt.Errorf("unknown redact action %q", name)
+}
+
+// A RedactDetector finds sensitive substrings in s and returns their
+// [start, end) byte offsets, like regexp.Regexp.FindAllStringIndex.
+type RedactDetector func(s string) [][]int
+
+// A RedactRule describes sensitive data and what to do with it.
+type RedactRule struct {
+	// Keys are case-insensitive glob patterns, as understood by path.Match.
+	// The whole value of a field whose key matches is redacted, whatever its
+	// type.
+	Keys []string
+	// Detect finds sensitive substrings in messages, string values and the
+	// decimal form of integers.
+	Detect RedactDetector
+	// Action is applied to the matches.
+	Action RedactAction
+}
+
+// RedactPattern returns a RedactDetector that reports the matches of re.
+func RedactPattern(re *regexp.Regexp) RedactDetector {
+	return func(s string) [][]int {
+		return re.FindAllStringIndex(s, -1)
+	}
+}
+
+// _digitRun matches runs of digits, optionally with a leading + and a
+// trailing X for ID card numbers. Detectors work on whole runs so that
+// numbers embedded in longer ones aren't reported.
+var _digitRun = regexp.MustCompile(`\+?\d+[Xx]?`)
+
+func detectDigitRuns(s string, match func(run string) bool) [][]int {
+	var spans [][]int
+	for _, span := range _digitRun.FindAllStringIndex(s, -1) {
+		if match(s[span[0]:span[1]]) {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+// DetectBankCard finds bank card numbers: 13 to 19 digits passing the Luhn
+// check.
+func DetectBankCard(s string) [][]int {
+	return detectDigitRuns(s, func(run string) bool {
+		if len(run) < 13 || len(run) > 19 || !isDigits(run) {
+			return false
+		}
+		return luhnValid(run)
+	})
+}
+
+// DetectChinaID finds mainland China resident ID card numbers: 18
+// characters with a valid birth date and check digit.
+func DetectChinaID(s string) [][]int {
+	return detectDigitRuns(s, chinaIDValid)
+}
+
+// DetectChinaMobile finds mainland China mobile numbers, optionally prefixed
+// with 86 or +86.
+func DetectChinaMobile(s string) [][]int {
+	return detectDigitRuns(s, func(run string) bool {
+		run = strings.TrimPrefix(run, "+86")
+		if len(run) == 13 && strings.HasPrefix(run, "86") {
+			run = run[2:]
+		}
+		return len(run) == 11 && isDigits(run) && run[0] == '1' && run[1] >= '3' && run[1] <= '9'
+	})
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return len(s) > 0
+}
+
+func luhnValid(number string) bool {
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+var _chinaIDWeights = [17]int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+
+const _chinaIDCheckCodes = "10X98765432"
+
+func chinaIDValid(id string) bool {
+	if len(id) != 18 || !isDigits(id[:17]) || id[0] == '0' {
+		return false
+	}
+	month, _ := strconv.Atoi(id[10:12])
+	day, _ := strconv.Atoi(id[12:14])
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return false
+	}
+	sum := 0
+	for i, w := range _chinaIDWeights {
+		sum += int(id[i]-'0') * w
+	}
+	check := id[17]
+	if check == 'x' {
+		check = 'X'
+	}
+	return _chinaIDCheckCodes[sum%11] == check
+}
+
+// redactor applies a set of rules to keys and text.
+type redactor struct {
+	rules []RedactRule
+}
+
+func newRedactor(rules []RedactRule) *redactor {
+	r := &redactor{rules: make([]RedactRule, len(rules))}
+	for i, rule := range rules {
+		keys := make([]string, len(rule.Keys))
+		for j, k := range rule.Keys {
+			keys[j] = strings.ToLower(k)
+		}
+		rule.Keys = keys
+		r.rules[i] = rule
+	}
+	return r
+}
+
+// keyAction returns the action of the first rule whose keys match key.
+func (r *redactor) keyAction(key string) (RedactAction, bool) {
+	if key == "" {
+		return 0, false
+	}
+	lower := strings.ToLower(key)
+	for _, rule := range r.rules {
+		for _, pattern := range rule.Keys {
+			if ok, _ := path.Match(pattern, lower); ok {
+				return rule.Action, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// value returns what replaces a whole value whose key matched a rule. The
+// value is only formatted when it's hashed.
+func (r *redactor) value(action RedactAction, v interface{}) string {
+	if action == RedactHash {
+		return hashRedacted(fmt.Sprint(v))
+	}
+	return _redactedMask
+}
+
+// text applies every detector to s. It reports whether s changed, and
+// whether a rule with RedactDrop matched.
+func (r *redactor) text(s string) (out string, changed, drop bool) {
+	out = s
+	for _, rule := range r.rules {
+		if rule.Detect == nil {
+			continue
+		}
+		spans := rule.Detect(out)
+		if len(spans) == 0 {
+			continue
+		}
+		changed = true
+		if rule.Action == RedactDrop {
+			drop = true
+		}
+		var b strings.Builder
+		last := 0
+		for _, span := range spans {
+			if span[0] < last {
+				continue
+			}
+			b.WriteString(out[last:span[0]])
+			match := out[span[0]:span[1]]
+			switch rule.Action {
+			case RedactHash:
+				b.WriteString(hashRedacted(match))
+			case RedactDrop:
+				b.WriteString(_redactedText)
+			default:
+				b.WriteString(maskRedacted(match))
+			}
+			last = span[1]
+		}
+		b.WriteString(out[last:])
+		out = b.String()
+	}
+	return out, changed, drop
+}
+
+// hasDetectors reports whether any rule inspects text.
+func (r *redactor) hasDetectors() bool {
+	for _, rule := range r.rules {
+		if rule.Detect != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hashRedacted(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+func maskRedacted(s string) string {
+	runes := []rune(s)
+	if len(runes) < 8 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:3]) + strings.Repeat("*", len(runes)-7) + string(runes[len(runes)-4:])
+}
+
+type redactCore struct {
+	Core
+	r *redactor
+}
+
+// NewRedactCore creates a Core that removes sensitive data before entries
+// reach the wrapped Core. Each field is checked against the rules' Keys
+// first; string values, errors, Stringers and integers are then scanned by
+// the rules' detectors, as is the message. Redaction also applies inside
+// ObjectMarshalers, ArrayMarshalers and reflected values.
+//
+// For example, the following masks passwords and tokens, and hashes phone
+// numbers wherever they appear:
+//
+//   core.NewRedactCore(c,
+//     core.RedactRule{Keys: []string{"password", "*token*"}},
+//     core.RedactRule{Detect: core.DetectChinaMobile, Action: core.RedactHash},
+//   )
+func NewRedactCore(core Core, rules ...RedactRule) Core {
+	return &redactCore{Core: core, r: newRedactor(rules)}
+}
+
+func (c *redactCore) With(fields []Field) Core {
+	return &redactCore{
+		Core: c.Core.With(c.r.fields(fields)),
+		r:    c.r,
+	}
+}
+
+func (c *redactCore) Check(ent Entry, ce *CheckedEntry) *CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *redactCore) Write(ent Entry, fields []Field) error {
+	if msg, changed, _ := c.r.text(ent.Message); changed {
+		ent.Message = msg
+	}
+	return writeChecked(c.Core, ent, c.r.fields(fields))
+}
+
+// fields returns a redacted copy of fields. The input is left untouched.
+func (r *redactor) fields(fields []Field) []Field {
+	out := make([]Field, 0, len(fields))
+	for _, f := range fields {
+		if f, keep := r.field(f); keep {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// field redacts a single field, reporting false if it should be dropped.
+func (r *redactor) field(f Field) (Field, bool) {
+	switch f.Type {
+	case NamespaceType, SkipType:
+		return f, true
+	}
+
+	if action, ok := r.keyAction(f.Key); ok {
+		if action == RedactDrop {
+			return f, false
+		}
+		var v interface{}
+		if action == RedactHash {
+			enc := NewMapObjectEncoder()
+			f.AddTo(enc)
+			v = enc.Fields[f.Key]
+		}
+		return Field{Key: f.Key, Type: StringType, String: r.value(action, v)}, true
+	}
+
+	switch f.Type {
+	case StringType:
+		return r.stringField(f, f.String)
+	case ByteStringType:
+		return r.stringField(f, string(f.Interface.([]byte)))
+	case Int64Type, Int32Type, Int16Type, Int8Type:
+		return r.stringField(f, strconv.FormatInt(f.Integer, 10))
+	case Uint64Type, Uint32Type, Uint16Type, Uint8Type, UintptrType:
+		return r.stringField(f, strconv.FormatUint(uint64(f.Integer), 10))
+	case StringerType:
+		if s, ok := f.Interface.(fmt.Stringer); ok && r.hasDetectors() {
+			if text, ok := safeText(s.String); ok {
+				return r.stringField(f, text)
+			}
+		}
+	case ErrorType:
+		if err, ok := f.Interface.(error); ok && r.hasDetectors() {
+			if text, ok := safeText(err.Error); ok {
+				return r.stringField(f, text)
+			}
+		}
+	case ObjectMarshalerType, InlineMarshalerType:
+		f.Interface = redactedObject{f.Interface.(ObjectMarshaler), r}
+	case ArrayMarshalerType:
+		f.Interface = redactedArray{f.Interface.(ArrayMarshaler), r}
+	case ReflectType:
+		if v, changed, drop := r.reflected(f.Interface); drop {
+			return f, false
+		} else if changed {
+			f.Interface = v
+		}
+	}
+	return f, true
+}
+
+// safeText calls a String or Error method, reporting false if it panics, as
+// it does for typed nil pointers with value receivers. The field is then left
+// alone, so that the encoder reports the panic as it would without redaction.
+func safeText(text func() string) (s string, ok bool) {
+	defer func() {
+		if recover() != nil {
+			s, ok = "", false
+		}
+	}()
+	return text(), true
+}
+
+// stringField replaces f with a string field if detectors changed s.
+func (r *redactor) stringField(f Field, s string) (Field, bool) {
+	out, changed, drop := r.text(s)
+	if drop {
+		return f, false
+	}
+	if !changed {
+		return f, true
+	}
+	return Field{Key: f.Key, Type: StringType, String: out}, true
+}
@@ -0,0 +1,386 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redactedObject applies redaction while an ObjectMarshaler encodes itself.
+type redactedObject struct {
+	m ObjectMarshaler
+	r *redactor
+}
+
+func (o redactedObject) MarshalLogObject(enc ObjectEncoder) error {
+	return o.m.MarshalLogObject(&redactObjectEncoder{enc, o.r})
+}
+
+// redactedArray applies redaction while an ArrayMarshaler encodes itself.
+type redactedArray struct {
+	m ArrayMarshaler
+	r *redactor
+}
+
+func (a redactedArray) MarshalLogArray(enc ArrayEncoder) error {
+	return a.m.MarshalLogArray(&redactArrayEncoder{enc, a.r})
+}
+
+// reflected redacts an arbitrary value by round-tripping it through JSON,
+// which is how encoders serialize reflected values. It reports whether the
+// value changed and whether it should be dropped altogether.
+func (r *redactor) reflected(v interface{}) (interface{}, bool, bool) {
+	if v == nil {
+		return v, false, false
+	}
+	switch s := v.(type) {
+	case string:
+		out, changed, drop := r.text(s)
+		return out, changed, drop
+	case bool, float32, float64:
+		return v, false, false
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		// Leave it to the encoder to report the error.
+		return v, false, false
+	}
+	// Decode numbers as json.Number so that long card and ID numbers keep
+	// all their digits; float64 only holds 15 or so.
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return v, false, false
+	}
+	out, changed, drop := r.walk(generic)
+	if !changed {
+		return v, false, drop
+	}
+	return out, true, drop
+}
+
+// walk redacts a value decoded from JSON in place.
+func (r *redactor) walk(v interface{}) (interface{}, bool, bool) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		changed := false
+		for k, elem := range t {
+			if action, ok := r.keyAction(k); ok {
+				changed = true
+				if action == RedactDrop {
+					delete(t, k)
+				} else {
+					t[k] = r.value(action, elem)
+				}
+				continue
+			}
+			out, elemChanged, drop := r.walk(elem)
+			if drop {
+				delete(t, k)
+				changed = true
+			} else if elemChanged {
+				t[k] = out
+				changed = true
+			}
+		}
+		return t, changed, false
+	case []interface{}:
+		changed := false
+		kept := t[:0]
+		for _, elem := range t {
+			out, elemChanged, drop := r.walk(elem)
+			if drop {
+				changed = true
+				continue
+			}
+			changed = changed || elemChanged
+			kept = append(kept, out)
+		}
+		return kept, changed, false
+	case string:
+		return r.text(t)
+	case json.Number:
+		if isDigits(strings.TrimPrefix(string(t), "-")) {
+			out, changed, drop := r.text(string(t))
+			if changed || drop {
+				return out, changed, drop
+			}
+		}
+	}
+	return v, false, false
+}
+
+// redactObjectEncoder wraps an ObjectEncoder and redacts what's added to it.
+type redactObjectEncoder struct {
+	enc ObjectEncoder
+	r   *redactor
+}
+
+// redactKey handles a key matching a rule, reporting whether it did.
+func (e *redactObjectEncoder) redactKey(key string, v interface{}) bool {
+	action, ok := e.r.keyAction(key)
+	if !ok {
+		return false
+	}
+	if action != RedactDrop {
+		e.enc.AddString(key, e.r.value(action, v))
+	}
+	return true
+}
+
+func (e *redactObjectEncoder) addText(key, s string) bool {
+	out, changed, drop := e.r.text(s)
+	if drop {
+		return true
+	}
+	if changed {
+		e.enc.AddString(key, out)
+		return true
+	}
+	return false
+}
+
+func (e *redactObjectEncoder) AddArray(key string, v ArrayMarshaler) error {
+	if e.redactKey(key, nil) {
+		return nil
+	}
+	return e.enc.AddArray(key, redactedArray{v, e.r})
+}
+
+func (e *redactObjectEncoder) AddObject(key string, v ObjectMarshaler) error {
+	if e.redactKey(key, nil) {
+		return nil
+	}
+	return e.enc.AddObject(key, redactedObject{v, e.r})
+}
+
+func (e *redactObjectEncoder) AddBinary(key string, v []byte) {
+	if !e.redactKey(key, v) {
+		e.enc.AddBinary(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddByteString(key string, v []byte) {
+	if !e.redactKey(key, string(v)) && !e.addText(key, string(v)) {
+		e.enc.AddByteString(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddBool(key string, v bool) {
+	if !e.redactKey(key, v) {
+		e.enc.AddBool(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddComplex128(key string, v complex128) {
+	if !e.redactKey(key, v) {
+		e.enc.AddComplex128(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddComplex64(key string, v complex64) {
+	if !e.redactKey(key, v) {
+		e.enc.AddComplex64(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddDuration(key string, v time.Duration) {
+	if !e.redactKey(key, v) {
+		e.enc.AddDuration(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddFloat64(key string, v float64) {
+	if !e.redactKey(key, v) {
+		e.enc.AddFloat64(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddFloat32(key string, v float32) {
+	if !e.redactKey(key, v) {
+		e.enc.AddFloat32(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddInt(key string, v int) {
+	if !e.redactKey(key, v) && !e.addText(key, strconv.Itoa(v)) {
+		e.enc.AddInt(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddInt64(key string, v int64) {
+	if !e.redactKey(key, v) && !e.addText(key, strconv.FormatInt(v, 10)) {
+		e.enc.AddInt64(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddInt32(key string, v int32) {
+	if !e.redactKey(key, v) {
+		e.enc.AddInt32(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddInt16(key string, v int16) {
+	if !e.redactKey(key, v) {
+		e.enc.AddInt16(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddInt8(key string, v int8) {
+	if !e.redactKey(key, v) {
+		e.enc.AddInt8(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddString(key, v string) {
+	if !e.redactKey(key, v) && !e.addText(key, v) {
+		e.enc.AddString(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddTime(key string, v time.Time) {
+	if !e.redactKey(key, v) {
+		e.enc.AddTime(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddUint(key string, v uint) {
+	if !e.redactKey(key, v) && !e.addText(key, strconv.FormatUint(uint64(v), 10)) {
+		e.enc.AddUint(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddUint64(key string, v uint64) {
+	if !e.redactKey(key, v) && !e.addText(key, strconv.FormatUint(v, 10)) {
+		e.enc.AddUint64(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddUint32(key string, v uint32) {
+	if !e.redactKey(key, v) {
+		e.enc.AddUint32(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddUint16(key string, v uint16) {
+	if !e.redactKey(key, v) {
+		e.enc.AddUint16(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddUint8(key string, v uint8) {
+	if !e.redactKey(key, v) {
+		e.enc.AddUint8(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddUintptr(key string, v uintptr) {
+	if !e.redactKey(key, v) {
+		e.enc.AddUintptr(key, v)
+	}
+}
+
+func (e *redactObjectEncoder) AddReflected(key string, v interface{}) error {
+	if e.redactKey(key, v) {
+		return nil
+	}
+	out, _, drop := e.r.reflected(v)
+	if drop {
+		return nil
+	}
+	return e.enc.AddReflected(key, out)
+}
+
+func (e *redactObjectEncoder) OpenNamespace(key string) {
+	e.enc.OpenNamespace(key)
+}
+
+// redactArrayEncoder wraps an ArrayEncoder and runs detectors on the
+// elements appended to it. Elements have no keys, so only detectors apply.
+type redactArrayEncoder struct {
+	enc ArrayEncoder
+	r   *redactor
+}
+
+func (e *redactArrayEncoder) appendText(s string) bool {
+	out, changed, drop := e.r.text(s)
+	if drop {
+		return true
+	}
+	if changed {
+		e.enc.AppendString(out)
+		return true
+	}
+	return false
+}
+
+func (e *redactArrayEncoder) AppendBool(v bool)              { e.enc.AppendBool(v) }
+func (e *redactArrayEncoder) AppendComplex128(v complex128)  { e.enc.AppendComplex128(v) }
+func (e *redactArrayEncoder) AppendComplex64(v complex64)    { e.enc.AppendComplex64(v) }
+func (e *redactArrayEncoder) AppendFloat64(v float64)        { e.enc.AppendFloat64(v) }
+func (e *redactArrayEncoder) AppendFloat32(v float32)        { e.enc.AppendFloat32(v) }
+func (e *redactArrayEncoder) AppendInt32(v int32)            { e.enc.AppendInt32(v) }
+func (e *redactArrayEncoder) AppendInt16(v int16)            { e.enc.AppendInt16(v) }
+func (e *redactArrayEncoder) AppendInt8(v int8)              { e.enc.AppendInt8(v) }
+func (e *redactArrayEncoder) AppendUint32(v uint32)          { e.enc.AppendUint32(v) }
+func (e *redactArrayEncoder) AppendUint16(v uint16)          { e.enc.AppendUint16(v) }
+func (e *redactArrayEncoder) AppendUint8(v uint8)            { e.enc.AppendUint8(v) }
+func (e *redactArrayEncoder) AppendUintptr(v uintptr)        { e.enc.AppendUintptr(v) }
+func (e *redactArrayEncoder) AppendDuration(v time.Duration) { e.enc.AppendDuration(v) }
+func (e *redactArrayEncoder) AppendTime(v time.Time)         { e.enc.AppendTime(v) }
+
+func (e *redactArrayEncoder) AppendByteString(v []byte) {
+	if !e.appendText(string(v)) {
+		e.enc.AppendByteString(v)
+	}
+}
+
+func (e *redactArrayEncoder) AppendString(v string) {
+	if !e.appendText(v) {
+		e.enc.AppendString(v)
+	}
+}
+
+func (e *redactArrayEncoder) AppendInt(v int) {
+	if !e.appendText(strconv.Itoa(v)) {
+		e.enc.AppendInt(v)
+	}
+}
+
+func (e *redactArrayEncoder) AppendInt64(v int64) {
+	if !e.appendText(strconv.FormatInt(v, 10)) {
+		e.enc.AppendInt64(v)
+	}
+}
+
+func (e *redactArrayEncoder) AppendUint(v uint) {
+	if !e.appendText(strconv.FormatUint(uint64(v), 10)) {
+		e.enc.AppendUint(v)
+	}
+}
+
+func (e *redactArrayEncoder) AppendUint64(v uint64) {
+	if !e.appendText(strconv.FormatUint(v, 10)) {
+		e.enc.AppendUint64(v)
+	}
+}
+
+func (e *redactArrayEncoder) AppendArray(v ArrayMarshaler) error {
+	return e.enc.AppendArray(redactedArray{v, e.r})
+}
+
+func (e *redactArrayEncoder) AppendObject(v ObjectMarshaler) error {
+	return e.enc.AppendObject(redactedObject{v, e.r})
+}
+
+func (e *redactArrayEncoder) AppendReflected(v interface{}) error {
+	out, _, drop := e.r.reflected(v)
+	if drop {
+		return nil
+	}
+	return e.enc.AppendReflected(out)
+}
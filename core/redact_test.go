@@ -0,0 +1,134 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRedactDetectors(t *testing.T) {
+	tests := []struct {
+		name   string
+		detect RedactDetector
+		input  string
+		want   bool
+	}{
+		{"visa", DetectBankCard, "card 4111111111111111 paid", true},
+		{"unionpay 19 digits", DetectBankCard, "6217000010000000003", true},
+		{"luhn mismatch", DetectBankCard, "4111111111111112", false},
+		{"too short", DetectBankCard, "411111111111", false},
+		{"too long", DetectBankCard, "62170000100000000030", false},
+		{"id", DetectChinaID, "id=11010519491231002X", true},
+		{"id lower x", DetectChinaID, "11010519491231002x", true},
+		{"id digit check", DetectChinaID, "440304199001011233", true},
+		{"id bad check", DetectChinaID, "110105194912310021", false},
+		{"id bad month", DetectChinaID, "110105194913310021", false},
+		{"id leading zero", DetectChinaID, "010105194912310021", false},
+		{"mobile", DetectChinaMobile, "call 13812345678", true},
+		{"mobile +86", DetectChinaMobile, "+8613812345678", true},
+		{"mobile 86", DetectChinaMobile, "8613812345678", true},
+		{"mobile bad prefix", DetectChinaMobile, "12812345678", false},
+		{"mobile too short", DetectChinaMobile, "1381234567", false},
+		{"mobile embedded", DetectChinaMobile, "138123456789", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := len(tt.detect(tt.input)) > 0; got != tt.want {
+				t.Errorf("detect(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+type redactCard struct {
+	Holder string
+	Number uint64
+	Phone  int64
+	Amount float64
+}
+
+type redactStringer struct{ s string }
+
+func (s *redactStringer) String() string { return s.s }
+
+func TestRedactCore(t *testing.T) {
+	rules := []RedactRule{
+		{Keys: []string{"password", "*_token"}},
+		{Detect: DetectBankCard},
+		{Detect: DetectChinaMobile, Action: RedactDrop},
+	}
+	tests := []struct {
+		name    string
+		field   Field
+		want    string
+		notWant string
+	}{
+		{
+			name:    "key",
+			field:   Field{Key: "password", Type: StringType, String: "hunter2"},
+			want:    `"password":"******"`,
+			notWant: "hunter2",
+		},
+		{
+			name:    "key glob",
+			field:   Field{Key: "Access_Token", Type: StringType, String: "abc"},
+			want:    `"Access_Token":"******"`,
+			notWant: "abc",
+		},
+		{
+			name:    "string",
+			field:   Field{Key: "note", Type: StringType, String: "card 4111111111111111"},
+			want:    `"note":"card 411*********1111"`,
+			notWant: "4111111111111111",
+		},
+		{
+			name:    "integer",
+			field:   Field{Key: "card", Type: Uint64Type, Integer: 6217000010000000003},
+			notWant: "6217000010000000003",
+		},
+		{
+			name:    "dropped",
+			field:   Field{Key: "phone", Type: StringType, String: "13812345678"},
+			notWant: "phone",
+		},
+		{
+			name:    "reflected",
+			field:   Field{Key: "card", Type: ReflectType, Interface: redactCard{Holder: "Li", Number: 6217000010000000003, Amount: 9.5}},
+			want:    `"Number":"621************0003"`,
+			notWant: "6217000010000000003",
+		},
+		{
+			name:    "reflected dropped",
+			field:   Field{Key: "card", Type: ReflectType, Interface: redactCard{Holder: "Li", Number: 1234567890123456789, Phone: 13812345678}},
+			want:    `"Number":1234567890123456789`,
+			notWant: "Phone",
+		},
+		{
+			name:  "reflected unchanged",
+			field: Field{Key: "card", Type: ReflectType, Interface: redactCard{Holder: "Li", Number: 1234567890123456789}},
+			want:  `"Number":1234567890123456789`,
+		},
+		{
+			name:  "nil stringer",
+			field: Field{Key: "s", Type: StringerType, Interface: (*redactStringer)(nil)},
+			want:  `"s":"<nil>"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := NewJSONEncoder(EncoderConfig{MessageKey: "msg"})
+			c := NewRedactCore(NewCore(enc, AddSync(&buf), DebugLevel), rules...)
+			if err := c.Write(Entry{Message: "m"}, []Field{tt.field}); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			out := buf.String()
+			if tt.want != "" && !strings.Contains(out, tt.want) {
+				t.Errorf("expected %s in %s", tt.want, out)
+			}
+			if tt.notWant != "" && strings.Contains(out, tt.notWant) {
+				t.Errorf("unexpected %s in %s", tt.notWant, out)
+			}
+		})
+	}
+}
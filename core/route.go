@@ -0,0 +1,202 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/zhangdapeng520/zdpgo_log/multierr"
+)
+
+// RouteMode decides how many routes an entry is sent to.
+type RouteMode uint8
+
+const (
+	// RouteFirstMatch sends an entry to the first route that matches it.
+	RouteFirstMatch RouteMode = iota
+	// RouteAllMatches sends an entry to every route that matches it.
+	RouteAllMatches
+)
+
+// ParseRouteMode parses "first" or "all". The empty string parses as
+// RouteFirstMatch.
+func ParseRouteMode(name string) (RouteMode, error) {
+	switch strings.ToLower(name) {
+	case "", "first":
+		return RouteFirstMatch, nil
+	case "all":
+		return RouteAllMatches, nil
+	}
+	return RouteFirstMatch, fmt.Errorf("unknown route mode %q", name)
+}
+
+// A Route sends the entries that satisfy all of its conditions to Core.
+// Conditions left empty match every entry.
+type Route struct {
+	// Level matches entries whose level it enables.
+	Level LevelEnabler
+	// Names matches entries whose logger name matches any of these glob
+	// patterns, as understood by path.Match (e.g. "payments.*").
+	Names []string
+	// Field and Value match entries carrying a field named Field, either
+	// from With or from the call site, whose value matches the glob pattern
+	// Value. An empty Value only requires the field to be present.
+	Field string
+	Value string
+	// AlsoDefault also sends the matching entries to the router's default
+	// Core, which otherwise only receives entries that match no route.
+	AlsoDefault bool
+	// Core receives the matching entries.
+	Core Core
+}
+
+// matchEntry reports whether the level and name conditions match ent.
+func (r *Route) matchEntry(ent Entry) bool {
+	if r.Level != nil && !r.Level.Enabled(ent.Level) {
+		return false
+	}
+	if len(r.Names) == 0 {
+		return true
+	}
+	for _, pattern := range r.Names {
+		if ok, _ := path.Match(pattern, ent.LoggerName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFields reports whether the field condition matches fields.
+func (r *Route) matchFields(fields []Field) bool {
+	if r.Field == "" {
+		return true
+	}
+	v, ok := fieldString(fields, r.Field)
+	if !ok {
+		return false
+	}
+	if r.Value == "" {
+		return true
+	}
+	matched, _ := path.Match(r.Value, v)
+	return matched
+}
+
+type router struct {
+	routes  []Route
+	def     Core
+	mode    RouteMode
+	context []Field
+	fields  bool // whether any route has a field condition
+}
+
+// NewRouter creates a Core that dispatches each entry to the Cores of the
+// routes that match it, as opposed to NewTee, which sends every entry
+// everywhere. With RouteFirstMatch only the first matching route is used;
+// with RouteAllMatches every matching route is. Entries that match no route,
+// or that are sent to a route with AlsoDefault, go to def, which may be nil
+// to drop them.
+//
+// For example, the following sends "payments.*" loggers to their own file
+// only, and copies everything at ErrorLevel and above to an alert sink in
+// addition to the main one:
+//
+//   core.NewRouter([]core.Route{
+//     {Names: []string{"payments.*"}, Core: paymentsCore},
+//     {Level: core.ErrorLevel, Core: alertCore, AlsoDefault: true},
+//   }, mainCore, core.RouteAllMatches)
+func NewRouter(routes []Route, def Core, mode RouteMode) Core {
+	r := &router{
+		routes: append([]Route(nil), routes...),
+		def:    def,
+		mode:   mode,
+	}
+	for i := range r.routes {
+		if r.routes[i].Field != "" {
+			r.fields = true
+		}
+	}
+	return r
+}
+
+func (r *router) Enabled(lvl Level) bool {
+	for i := range r.routes {
+		route := &r.routes[i]
+		if (route.Level == nil || route.Level.Enabled(lvl)) && route.Core.Enabled(lvl) {
+			return true
+		}
+	}
+	return r.def != nil && r.def.Enabled(lvl)
+}
+
+func (r *router) With(fields []Field) Core {
+	clone := &router{
+		routes:  make([]Route, len(r.routes)),
+		mode:    r.mode,
+		fields:  r.fields,
+		context: r.context,
+	}
+	for i, route := range r.routes {
+		route.Core = route.Core.With(fields)
+		clone.routes[i] = route
+	}
+	if r.def != nil {
+		clone.def = r.def.With(fields)
+	}
+	if r.fields {
+		clone.context = joinFields(r.context, fields)
+	}
+	return clone
+}
+
+func (r *router) Check(ent Entry, ce *CheckedEntry) *CheckedEntry {
+	// Field conditions can only be evaluated once the call-site fields are
+	// known, so register as long as some destination might want the entry.
+	for i := range r.routes {
+		route := &r.routes[i]
+		if route.matchEntry(ent) && route.Core.Enabled(ent.Level) {
+			return ce.AddCore(ent, r)
+		}
+	}
+	if r.def != nil && r.def.Enabled(ent.Level) {
+		return ce.AddCore(ent, r)
+	}
+	return ce
+}
+
+func (r *router) Write(ent Entry, fields []Field) error {
+	var all []Field
+	if r.fields {
+		all = joinFields(r.context, fields)
+	}
+
+	var err error
+	matched, toDefault := false, false
+	for i := range r.routes {
+		route := &r.routes[i]
+		if !route.matchEntry(ent) || !route.matchFields(all) {
+			continue
+		}
+		matched = true
+		toDefault = toDefault || route.AlsoDefault
+		err = multierr.Append(err, writeChecked(route.Core, ent, fields))
+		if r.mode == RouteFirstMatch {
+			break
+		}
+	}
+	if (!matched || toDefault) && r.def != nil {
+		err = multierr.Append(err, writeChecked(r.def, ent, fields))
+	}
+	return err
+}
+
+func (r *router) Sync() error {
+	var err error
+	for i := range r.routes {
+		err = multierr.Append(err, r.routes[i].Core.Sync())
+	}
+	if r.def != nil {
+		err = multierr.Append(err, r.def.Sync())
+	}
+	return err
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	type sinks struct{ payments, alert, audit, def bytes.Buffer }
+	newRouter := func(s *sinks, mode RouteMode) Core {
+		enc := NewConsoleEncoder(EncoderConfig{MessageKey: "msg"})
+		newCore := func(buf *bytes.Buffer) Core { return NewCore(enc.Clone(), AddSync(buf), DebugLevel) }
+		return NewRouter([]Route{
+			{Names: []string{"payments.*"}, Core: newCore(&s.payments)},
+			{Level: ErrorLevel, Core: newCore(&s.alert), AlsoDefault: true},
+			{Field: "tenant", Value: "acme-*", Core: newCore(&s.audit)},
+		}, newCore(&s.def), mode)
+	}
+
+	tests := []struct {
+		name   string
+		mode   RouteMode
+		ent    Entry
+		fields []Field
+		with   []Field
+		// want lists the sinks that receive the entry, in sinks order.
+		want [4]bool
+	}{
+		{
+			name: "no match",
+			ent:  Entry{Level: InfoLevel, LoggerName: "http"},
+			want: [4]bool{false, false, false, true},
+		},
+		{
+			name: "glob name",
+			ent:  Entry{Level: InfoLevel, LoggerName: "payments.refund"},
+			want: [4]bool{true, false, false, false},
+		},
+		{
+			name: "glob name mismatch",
+			ent:  Entry{Level: InfoLevel, LoggerName: "payments"},
+			want: [4]bool{false, false, false, true},
+		},
+		{
+			name: "first match",
+			ent:  Entry{Level: ErrorLevel, LoggerName: "payments.refund"},
+			want: [4]bool{true, false, false, false},
+		},
+		{
+			name: "all matches",
+			mode: RouteAllMatches,
+			ent:  Entry{Level: ErrorLevel, LoggerName: "payments.refund"},
+			want: [4]bool{true, true, false, true},
+		},
+		{
+			name: "also default",
+			ent:  Entry{Level: ErrorLevel, LoggerName: "http"},
+			want: [4]bool{false, true, false, true},
+		},
+		{
+			name:   "field value",
+			ent:    Entry{Level: InfoLevel, LoggerName: "http"},
+			fields: []Field{{Key: "tenant", Type: StringType, String: "acme-eu"}},
+			want:   [4]bool{false, false, true, false},
+		},
+		{
+			name:   "field value mismatch",
+			ent:    Entry{Level: InfoLevel, LoggerName: "http"},
+			fields: []Field{{Key: "tenant", Type: StringType, String: "globex"}},
+			want:   [4]bool{false, false, false, true},
+		},
+		{
+			name: "field from With",
+			mode: RouteAllMatches,
+			ent:  Entry{Level: ErrorLevel, LoggerName: "http"},
+			with: []Field{{Key: "tenant", Type: StringType, String: "acme-us"}},
+			want: [4]bool{false, true, true, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s sinks
+			c := newRouter(&s, tt.mode)
+			if tt.with != nil {
+				c = c.With(tt.with)
+			}
+			ce := c.Check(tt.ent, nil)
+			if ce == nil {
+				t.Fatal("entry not accepted by the router")
+			}
+			ce.Write(tt.fields...)
+			for i, buf := range []*bytes.Buffer{&s.payments, &s.alert, &s.audit, &s.def} {
+				if got := buf.Len() > 0; got != tt.want[i] {
+					t.Errorf("sink %d: got output %v, want %v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRouterNilDefault(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewConsoleEncoder(EncoderConfig{MessageKey: "msg"})
+	c := NewRouter([]Route{
+		{Level: ErrorLevel, Core: NewCore(enc, AddSync(&buf), DebugLevel), AlsoDefault: true},
+	}, nil, RouteFirstMatch)
+
+	if c.Enabled(InfoLevel) {
+		t.Error("expected InfoLevel to be disabled without a default core")
+	}
+	if ce := c.Check(Entry{Level: ErrorLevel, Message: "boom"}, nil); ce != nil {
+		ce.Write()
+	}
+	if !strings.Contains(buf.String(), "boom") {
+		t.Errorf("expected the error in the route, got %q", buf.String())
+	}
+}
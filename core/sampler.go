@@ -125,7 +125,8 @@ func SamplerHook(hook func(entry Entry, dec SamplingDecision)) SamplerOption {
 // in that interval.
 //
 // Sampler can be configured to report sampling decisions with the SamplerHook
-// option.
+// option. Different settings can be applied per logger name or field value
+// with the SamplerRules option.
 //
 // Keep in mind that Zap's sampling implementation is optimized for speed over
 // absolute precision; under load, each tick may be slightly over- or
@@ -138,6 +139,7 @@ func NewSamplerWithOptions(core Core, tick time.Duration, first, thereafter int,
 		first:      uint64(first),
 		thereafter: uint64(thereafter),
 		hook:       nopSamplingHook,
+		ruleHook:   nopSamplingRuleHook,
 	}
 	for _, opt := range opts {
 		opt.apply(s)
@@ -153,6 +155,9 @@ type sampler struct {
 	tick              time.Duration
 	first, thereafter uint64
 	hook              func(Entry, SamplingDecision)
+	ruleHook          func(Entry, SamplingDecision, string)
+	rules             []*samplingRule
+	context           []Field // only tracked when rules need field values
 }
 
 // NewSampler creates a Core that samples incoming entries, which
@@ -180,6 +185,9 @@ func (s *sampler) With(fields []Field) Core {
 		first:      s.first,
 		thereafter: s.thereafter,
 		hook:       s.hook,
+		ruleHook:   s.ruleHook,
+		rules:      s.rules,
+		context:    s.withContext(fields),
 	}
 }
 
@@ -189,13 +197,35 @@ func (s *sampler) Check(ent Entry, ce *CheckedEntry) *CheckedEntry {
 	}
 
 	if ent.Level >= _minLevel && ent.Level <= _maxLevel {
-		counter := s.counts.get(ent.Level, ent.Message)
-		n := counter.IncCheckReset(ent.Time, s.tick)
-		if n > s.first && (s.thereafter == 0 || (n-s.first)%s.thereafter != 0) {
-			s.hook(ent, LogDropped)
+		rule, deferred := s.ruleForName(ent.LoggerName)
+		if deferred {
+			// The rule depends on field values, which are only known in
+			// Write.
+			return ce.AddCore(ent, fieldSampler{s})
+		}
+		if !s.sample(ent, rule, ent.Message) {
 			return ce
 		}
-		s.hook(ent, LogSampled)
 	}
 	return s.Core.Check(ent, ce)
 }
+
+// sample counts ent against rule, or against the sampler's own settings if
+// rule is nil, and reports whether it should be logged.
+func (s *sampler) sample(ent Entry, rule *samplingRule, key string) bool {
+	counts, tick, first, thereafter, name := s.counts, s.tick, s.first, s.thereafter, ""
+	if rule != nil {
+		counts, tick, first, thereafter, name = rule.counts, rule.tick, rule.first, rule.thereafter, rule.name
+	}
+
+	counter := counts.get(ent.Level, key)
+	n := counter.IncCheckReset(ent.Time, tick)
+	if n > first && (thereafter == 0 || (n-first)%thereafter != 0) {
+		s.hook(ent, LogDropped)
+		s.ruleHook(ent, LogDropped, name)
+		return false
+	}
+	s.hook(ent, LogSampled)
+	s.ruleHook(ent, LogSampled, name)
+	return true
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"path"
+	"time"
+)
+
+// A SamplingRule overrides the sampler's settings for some entries. Rules are
+// tried in order and the first matching one applies; entries matching no rule
+// are sampled with the settings passed to NewSamplerWithOptions.
+type SamplingRule struct {
+	// Name identifies the rule in SamplerRuleHook.
+	Name string
+	// Names are glob patterns, as understood by path.Match, matched against
+	// the logger name. An empty list matches every logger.
+	Names []string
+	// Field, if set, restricts the rule to entries with a field of that key,
+	// such as "user_id" or "endpoint". Each value of the field is counted
+	// separately, so that one noisy user doesn't use up everyone's budget.
+	Field string
+	// Tick, First and Thereafter have the same meaning as the arguments of
+	// NewSamplerWithOptions. A zero Tick uses the sampler's tick.
+	Tick       time.Duration
+	First      int
+	Thereafter int
+}
+
+type samplingRule struct {
+	name              string
+	names             []string
+	field             string
+	tick              time.Duration
+	first, thereafter uint64
+	counts            *counters
+}
+
+// SamplerRules sets rules that sample entries by logger name or field value,
+// each with its own tick, first and thereafter.
+//
+// Rules with a Field can only be evaluated once the entry's fields are known,
+// so for the loggers they match, sampling happens when the entry is written
+// rather than when it's checked.
+func SamplerRules(rules ...SamplingRule) SamplerOption {
+	return optionFunc(func(s *sampler) {
+		for _, r := range rules {
+			tick := r.Tick
+			if tick <= 0 {
+				tick = s.tick
+			}
+			s.rules = append(s.rules, &samplingRule{
+				name:       r.Name,
+				names:      r.Names,
+				field:      r.Field,
+				tick:       tick,
+				first:      uint64(r.First),
+				thereafter: uint64(r.Thereafter),
+				counts:     newCounters(),
+			})
+		}
+	})
+}
+
+// nopSamplingRuleHook is the default rule hook used by sampler.
+func nopSamplingRuleHook(Entry, SamplingDecision, string) {}
+
+// SamplerRuleHook registers a function which will be called when Sampler makes
+// a decision, along with the name of the SamplingRule that made it. The name
+// is empty for entries sampled with the sampler's own settings.
+func SamplerRuleHook(hook func(entry Entry, dec SamplingDecision, rule string)) SamplerOption {
+	return optionFunc(func(s *sampler) {
+		s.ruleHook = hook
+	})
+}
+
+func (r *samplingRule) matchName(name string) bool {
+	if len(r.names) == 0 {
+		return true
+	}
+	for _, pattern := range r.names {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleForName returns the first rule matching a logger name. It reports
+// deferred if a rule depending on field values must be considered first.
+func (s *sampler) ruleForName(name string) (rule *samplingRule, deferred bool) {
+	for _, r := range s.rules {
+		if !r.matchName(name) {
+			continue
+		}
+		if r.field != "" {
+			return nil, true
+		}
+		return r, false
+	}
+	return nil, false
+}
+
+// ruleForEntry returns the first rule matching a logger name and fields, and
+// the key to count the entry under.
+func (s *sampler) ruleForEntry(ent Entry, fields []Field) (*samplingRule, string) {
+	for _, r := range s.rules {
+		if !r.matchName(ent.LoggerName) {
+			continue
+		}
+		if r.field == "" {
+			return r, ent.Message
+		}
+		if v, ok := fieldString(fields, r.field); ok {
+			return r, v + "\x00" + ent.Message
+		}
+	}
+	return nil, ent.Message
+}
+
+// withContext returns the context to carry into a child sampler. It's only
+// kept when a rule looks at field values.
+func (s *sampler) withContext(fields []Field) []Field {
+	for _, r := range s.rules {
+		if r.field != "" {
+			return joinFields(s.context, fields)
+		}
+	}
+	return nil
+}
+
+// fieldSampler makes the sampling decision in Write, for rules that depend on
+// field values.
+type fieldSampler struct {
+	*sampler
+}
+
+func (f fieldSampler) Write(ent Entry, fields []Field) error {
+	rule, key := f.ruleForEntry(ent, joinFields(f.context, fields))
+	if !f.sample(ent, rule, key) {
+		return nil
+	}
+	return writeChecked(f.Core, ent, fields)
+}
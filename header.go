@@ -0,0 +1,55 @@
+package zdpgo_log
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// fileHeader 日志文件头中记录的信息
+type fileHeader struct {
+	Header     bool      `json:"header"`
+	AppVersion string    `json:"app_version,omitempty"`
+	Hostname   string    `json:"hostname"`
+	Pid        int       `json:"pid"`
+	StartTime  time.Time `json:"start_time"`
+	OpenTime   time.Time `json:"open_time"`
+	Config     LogConfig `json:"config"`
+}
+
+// newFileHeader 返回生成日志文件头的函数，每次打开新文件时调用
+//
+// JSON日志写入一行JSON对象，普通日志写入以"#"开头的一行，方便归档后识别文件来源。
+func newFileHeader(config LogConfig) func() []byte {
+	hostname, _ := os.Hostname()
+	startTime := time.Now()
+	return func() []byte {
+		header := fileHeader{
+			Header:     true,
+			AppVersion: config.AppVersion,
+			Hostname:   hostname,
+			Pid:        os.Getpid(),
+			StartTime:  startTime,
+			OpenTime:   time.Now(),
+			Config:     config,
+		}
+		if config.OpenJsonLog {
+			data, err := json.Marshal(header)
+			if err != nil {
+				return nil
+			}
+			return append(data, '\n')
+		}
+		configData, err := json.Marshal(header.Config)
+		if err != nil {
+			return nil
+		}
+		return []byte(fmt.Sprintf(
+			"# app_version=%s hostname=%s pid=%d start_time=%s open_time=%s config=%s\n",
+			header.AppVersion, header.Hostname, header.Pid,
+			header.StartTime.Format(time.RFC3339), header.OpenTime.Format(time.RFC3339),
+			configData,
+		))
+	}
+}
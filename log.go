@@ -1,10 +1,12 @@
 package zdpgo_log
 
 import (
+	"fmt"
 	"os"
 	"path"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/zhangdapeng520/zdpgo_log/colorable"
@@ -23,6 +25,11 @@ type Log struct {
 	Error   func(msg string, args ...interface{})
 	Panic   func(msg string, args ...interface{})
 	Fatal   func(msg string, args ...interface{})
+
+	writer    *lumberjack.Logger // 日志文件写入对象，同一路径的日志对象共享
+	writerKey string             // 写入对象在注册表中的key
+	closeOnce sync.Once
+	stopAsync func() // 停止异步写入
 }
 
 var (
@@ -88,7 +95,8 @@ func NewWithConfig(config *LogConfig) *Log {
 	dirName := path.Dir(config.LogFilePath)
 
 	// 创建日志文件夹
-	_ = createMultiDir(dirName)
+	dirMode, _ := parseFileMode(config.DirMode, os.ModePerm) // 格式错误在getLogWriter中报告
+	_ = createMultiDir(dirName, dirMode)
 
 	// 日志级别
 	if config.LogLevel == "" {
@@ -133,7 +141,9 @@ func NewWithConfig(config *LogConfig) *Log {
 	}
 
 	// 创建日志
-	writeSyncer := getLogWriter(*config)
+	writeSyncer, writerKey := acquireLogWriter(*config)
+	z.writer = writeSyncer
+	z.writerKey = writerKey
 	encoder := getEncoder(*config)
 	var ccore core.Core
 
@@ -144,19 +154,83 @@ func NewWithConfig(config *LogConfig) *Log {
 		debugSugarLogger *SugaredLogger
 	)
 
+	// 包装日志内容的函数，控制台debug日志和文件日志共用
+	wrapContent := newContentWrapper(*config)
+
 	// 创建在控制台显示debug日志，但是不写入到文件中
 	if config.Debug && !config.IsWriteDebug {
-		ccore = core.NewCore(encoder, core.AddSync(colorable.NewColorableStdout()), core.DebugLevel)
+		ccore = wrapContent(core.NewCore(encoder, core.AddSync(colorable.NewColorableStdout()), core.DebugLevel))
+		if config.Metadata != nil {
+			ccore = config.Metadata.wrap(ccore)
+		}
 		debugSugarLogger = New(ccore, AddCaller()).Sugar()
 		z.Debug = debugSugarLogger.Debugw
 	}
 
+	// 在内存中保留最近的低级别日志，出错时一并输出
+	// 记录器包在限速、过滤和合并重复日志之外，保留的日志输出前不计入统计和限速，因此底层core需同时启用保留的级别
+	var (
+		baseLevel core.LevelEnabler = logLevel
+		capture   core.Level
+		recOpts   []core.RecorderOption
+	)
+	if config.RecorderSize > 0 {
+		recorder := RecorderConfig{
+			Size:     int(config.RecorderSize),
+			MaxAge:   config.RecorderMaxAge,
+			Trigger:  config.RecorderTrigger,
+			ScopeKey: config.RecorderScope,
+		}
+		var err error
+		if capture, recOpts, err = recorder.options(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to parse log recorder config: %v\n", err)
+		} else {
+			baseLevel = withCaptured(logLevel, capture)
+			recOpts = append(recOpts, core.RecorderLevel(logLevel))
+		}
+	}
+
 	// 是否在控制台展示日志
 	if config.IsShowConsole {
 		writerObj := core.NewMultiWriteSyncer(writeSyncer, core.AddSync(colorable.NewColorableStdout()))
-		ccore = core.NewCore(encoder, writerObj, logLevel)
+		ccore = core.NewCore(encoder, writerObj, baseLevel)
 	} else {
-		ccore = core.NewCore(encoder, writeSyncer, logLevel)
+		ccore = core.NewCore(encoder, writeSyncer, baseLevel)
+	}
+
+	// 统计日志量
+	if config.Metrics != nil {
+		ccore = core.NewMetricsCore(ccore, config.Metrics, encoder.Clone())
+	}
+
+	// 限制日志写入速率
+	if config.RateLimitBytes > 0 || config.RateLimitEntries > 0 {
+		limit := core.RateLimit{
+			BytesPerSecond:   int(config.RateLimitBytes),
+			EntriesPerSecond: int(config.RateLimitEntries),
+		}
+		var opts []core.RateLimitOption
+		if config.Metrics != nil {
+			opts = append(opts, core.RateLimitMetrics(config.Metrics))
+		}
+		ccore = core.NewRateLimitCore(ccore, encoder.Clone(), limit, opts...)
+	}
+
+	// 过滤、脱敏、合并重复日志
+	ccore = wrapContent(ccore)
+
+	if recOpts != nil {
+		ccore = core.NewRecorderCore(ccore, capture, recOpts...)
+	}
+
+	// 异步写入日志
+	if config.Async {
+		ccore, z.stopAsync = newAsyncCore(ccore, *config)
+	}
+
+	// 添加进程和环境信息，需在异步写入之后，保证协程ID为调用方的
+	if config.Metadata != nil {
+		ccore = config.Metadata.wrap(ccore)
 	}
 
 	// 创建日志对象
@@ -184,6 +258,44 @@ func NewWithConfig(config *LogConfig) *Log {
 	return z
 }
 
+// Close 关闭日志对象，当同一日志文件的最后一个日志对象关闭时关闭文件
+func (z *Log) Close() error {
+	var err error
+	z.closeOnce.Do(func() {
+		if z.stopAsync != nil {
+			z.stopAsync()
+		}
+		if z.writer != nil {
+			err = releaseLogWriter(z.writerKey)
+		}
+	})
+	return err
+}
+
+// Stats 返回日志对象管理的每个日志文件的统计信息，key为文件名
+func (z *Log) Stats() map[string]lumberjack.Stats {
+	stats := make(map[string]lumberjack.Stats)
+	if z.writer != nil {
+		s := z.writer.Stats()
+		stats[s.Filename] = s
+	}
+	return stats
+}
+
+// NewWithLogger 根据已有的Logger创建日志对象，日志的输出完全由logger决定
+func NewWithLogger(logger *Logger) *Log {
+	sugarLogger := logger.Sugar()
+	return &Log{
+		Config:  &LogConfig{},
+		Debug:   sugarLogger.Debugw,
+		Info:    sugarLogger.Infow,
+		Warning: sugarLogger.Warnw,
+		Error:   sugarLogger.Errorw,
+		Panic:   sugarLogger.Panicw,
+		Fatal:   sugarLogger.Fatalw,
+	}
+}
+
 // NewWithDebug 根据debug值和日志路径创建日志对象
 func NewWithDebug(debug bool, logFilePath string) *Log {
 	logConfig := &LogConfig{
@@ -199,9 +311,9 @@ func NewWithDebug(debug bool, logFilePath string) *Log {
 }
 
 // 调用os.MkdirAll递归创建文件夹
-func createMultiDir(filePath string) error {
+func createMultiDir(filePath string, mode os.FileMode) error {
 	if !isExist(filePath) {
-		err := os.MkdirAll(filePath, os.ModePerm)
+		err := os.MkdirAll(filePath, mode)
 		if err != nil {
 			return err
 		}
@@ -216,6 +328,50 @@ func isExist(path string) bool {
 	return err == nil
 }
 
+// newContentWrapper 解析按日志内容处理的配置，返回按配置包装core的函数
+//
+// 配置错误会输出到标准错误，对应的功能不生效。
+func newContentWrapper(config LogConfig) func(core.Core) core.Core {
+	keep, err := newFilter(config.FilterKeep, config.FilterDrop)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to parse log filter: %v\n", err)
+	}
+
+	var redactRules []core.RedactRule
+	if config.Redact != nil {
+		if redactRules, err = config.Redact.rules(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to parse log redact config: %v\n", err)
+		}
+	}
+
+	var dedup *DedupConfig
+	if config.DedupWindow != "" {
+		dedup = &DedupConfig{Window: config.DedupWindow, Keys: config.DedupKeys}
+		if _, err := dedup.window(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to parse log dedup window: %v\n", err)
+			dedup = nil
+		}
+	}
+
+	return func(ccore core.Core) core.Core {
+		// 根据表达式过滤日志
+		if keep != nil {
+			ccore = core.NewFilterCore(ccore, keep)
+		}
+
+		// 敏感信息脱敏
+		if redactRules != nil {
+			ccore = core.NewRedactCore(ccore, redactRules...)
+		}
+
+		// 合并重复日志
+		if dedup != nil {
+			ccore, _ = dedup.build(ccore, config.Metrics)
+		}
+		return ccore
+	}
+}
+
 // 获取日志编码器
 func getEncoder(config LogConfig) core.Encoder {
 	// 配置对象
@@ -252,15 +408,60 @@ func getEncoder(config LogConfig) core.Encoder {
 }
 
 // 获取日志写入对象
-func getLogWriter(config LogConfig) core.WriteSyncer {
+func getLogWriter(config LogConfig) *lumberjack.Logger {
 	// 处理配置
 	config = getDefaultConfig(config)
+	oversize, err := lumberjack.ParseOversizePolicy(config.Oversize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to parse log oversize policy: %v\n", err)
+	}
+	fsyncPolicy, err := lumberjack.ParseFsyncPolicy(config.FsyncPolicy)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to parse log fsync policy: %v\n", err)
+	}
+	var fsyncInterval time.Duration
+	if config.FsyncInterval != "" {
+		if fsyncInterval, err = time.ParseDuration(config.FsyncInterval); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to parse log fsync interval: %v\n", err)
+		}
+	}
+	fileMode, err := parseFileMode(config.FileMode, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to parse log file mode: %v\n", err)
+	}
+	dirMode, err := parseFileMode(config.DirMode, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to parse log dir mode: %v\n", err)
+	}
 	lumberJackLogger := &lumberjack.Logger{
 		Filename:   config.LogFilePath,     // 日志输出文件
 		MaxSize:    int(config.MaxSize),    // 日志最大保存1M
 		MaxBackups: int(config.MaxBackups), // 就日志保留5个备份
 		MaxAge:     int(config.MaxAge),     // 最多保留30个日志 和MaxBackups参数配置1个就可以
+		MaxLines:   int(config.MaxLines),   // 每个文件最多的日志行数
 		Compress:   config.Compress,        // 自动打 gzip包 默认false
+		Oversize:   oversize,               // 超大日志的处理策略
+
+		RotateOnStartup: config.RotateOnStartup, // 启动时创建新文件
+		BackupDir:       config.BackupDir,       // 备份目录
+
+		FsyncPolicy:   fsyncPolicy,              // 刷盘策略
+		FsyncBytes:    int64(config.FsyncBytes), // 每写入多少字节刷盘
+		FsyncInterval: fsyncInterval,            // 刷盘间隔
+
+		FileMode: fileMode,         // 日志文件权限
+		DirMode:  dirMode,          // 日志目录权限
+		Owner:    config.FileOwner, // 日志文件所属用户
+		Group:    config.FileGroup, // 日志文件所属用户组
+
+		MillConcurrency:    int(config.MillConcurrency),      // 压缩和删除的并发数
+		MillBytesPerSecond: int64(config.MillBytesPerSecond), // 压缩和删除的限速
+		CompressAfter:      int(config.CompressAfter),        // 最近的N个备份不压缩
+		Manifest:           config.Manifest,                  // 备份清单
+	}
+	if config.WriteHeader {
+		lumberJackLogger.Header = newFileHeader(config)
 	}
-	return core.AddSync(lumberJackLogger)
+	// lumberjack.Logger实现了Sync，调用Sync时会将文件刷入磁盘
+	return lumberJackLogger
 }
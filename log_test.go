@@ -1,12 +1,19 @@
 package zdpgo_log
 
 import (
+	"path/filepath"
 	"testing"
 )
 
+// 返回测试专用的临时日志文件路径，测试结束后自动删除
+func tempLogPath(t *testing.T) string {
+	return filepath.Join(t.TempDir(), "log.log")
+}
+
 func TestLog_New(t *testing.T) {
 	var log *Log
-	log = NewWithDebug(true, "c:/tmp/log.log")
+	log = NewWithDebug(true, tempLogPath(t))
+	defer log.Close()
 	log.Debug("ok")
 
 	Tmp.Debug("it is log by tmp log")
@@ -24,7 +31,9 @@ func TestLog_Debug(t *testing.T) {
 		IsWriteDebug:  true,
 		OpenJsonLog:   false,
 		IsShowConsole: true,
+		LogFilePath:   tempLogPath(t),
 	})
+	defer l.Close()
 	l.Debug("debug 222222日志。。。")
 
 	// 设置写入Debug日志，但是不显示在控制台
@@ -33,7 +42,9 @@ func TestLog_Debug(t *testing.T) {
 		IsWriteDebug:  true,
 		OpenJsonLog:   false,
 		IsShowConsole: false,
+		LogFilePath:   tempLogPath(t),
 	})
+	defer l.Close()
 	l.Debug("debug 3333333日志。。。")
 
 	// 设置写入Debug日志，但是显示在控制台，但是日志级别为Warning
@@ -43,7 +54,9 @@ func TestLog_Debug(t *testing.T) {
 		OpenJsonLog:   false,
 		IsShowConsole: true,
 		LogLevel:      "warning",
+		LogFilePath:   tempLogPath(t),
 	})
+	defer l.Close()
 	l.Debug("debug 4444444444日志。。。")
 }
 
@@ -54,8 +67,9 @@ func TestLog_Product(t *testing.T) {
 		IsWriteDebug:  false,
 		IsShowConsole: true,
 		OpenJsonLog:   false,
-		LogFilePath:   "c:/tmp/log.log",
+		LogFilePath:   tempLogPath(t),
 	})
+	defer l.Close()
 	l.Debug("日志。。。", "a", 1, "b", 2.2, "c", "333", "d", true)
 	l.Info("日志。。。", "a", 1, "b", 2.2, "c", "333", "d", true)
 	l.Warning("日志。。。", "a", 1, "b", 2.2, "c", "333", "d", true)
@@ -0,0 +1,56 @@
+package lumberjack
+
+import (
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_log/clock"
+)
+
+// Clock 时间来源，core.Clock和clock.Clock都满足该接口
+//
+// 如果同时实现了core.Clock的NewTicker或者clock.Clock的Ticker、Sleep方法，定时刷盘和mill限速的等待也会使用该时间来源，
+// 因此可以使用clock.Mock精确控制备份名、过期清理和定时任务。
+type Clock interface {
+	Now() time.Time
+}
+
+// now 返回当前时间
+func (l *Logger) now() time.Time {
+	if l.Clock != nil {
+		return l.Clock.Now()
+	}
+	return time.Now()
+}
+
+// newTicker 根据Clock创建定时器，返回定时通道和停止函数
+func (l *Logger) newTicker(d time.Duration) (<-chan time.Time, func()) {
+	switch c := l.Clock.(type) {
+	case interface {
+		Ticker(time.Duration) *clock.Ticker
+	}:
+		t := c.Ticker(d)
+		return t.C, t.Stop
+	case interface {
+		NewTicker(time.Duration) *time.Ticker
+	}:
+		t := c.NewTicker(d)
+		return t.C, t.Stop
+	}
+	t := time.NewTicker(d)
+	return t.C, t.Stop
+}
+
+// sleep 按照Clock等待d
+func (l *Logger) sleep(d time.Duration) {
+	if c, ok := l.Clock.(interface{ Sleep(time.Duration) }); ok {
+		c.Sleep(d)
+		return
+	}
+	if l.Clock == nil {
+		time.Sleep(d)
+		return
+	}
+	c, stop := l.newTicker(d)
+	defer stop()
+	<-c
+}
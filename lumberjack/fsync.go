@@ -0,0 +1,141 @@
+package lumberjack
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FsyncPolicy 控制日志文件调用fsync的时机
+type FsyncPolicy int
+
+const (
+	// FsyncNever 从不主动刷盘，由操作系统决定（默认）
+	FsyncNever FsyncPolicy = iota
+	// FsyncEveryWrite 每次写入后刷盘
+	FsyncEveryWrite
+	// FsyncEveryBytes 每写入FsyncBytes字节后刷盘
+	FsyncEveryBytes
+	// FsyncEveryInterval 每隔FsyncInterval刷盘一次
+	FsyncEveryInterval
+)
+
+const defaultFsyncInterval = time.Second
+
+// String 返回策略名称
+func (p FsyncPolicy) String() string {
+	switch p {
+	case FsyncNever:
+		return "never"
+	case FsyncEveryWrite:
+		return "write"
+	case FsyncEveryBytes:
+		return "bytes"
+	case FsyncEveryInterval:
+		return "interval"
+	}
+	return fmt.Sprintf("FsyncPolicy(%d)", int(p))
+}
+
+// ParseFsyncPolicy 根据名称解析刷盘策略，空字符串表示FsyncNever
+func ParseFsyncPolicy(name string) (FsyncPolicy, error) {
+	switch strings.ToLower(name) {
+	case "", "never":
+		return FsyncNever, nil
+	case "write":
+		return FsyncEveryWrite, nil
+	case "bytes":
+		return FsyncEveryBytes, nil
+	case "interval":
+		return FsyncEveryInterval, nil
+	}
+	return FsyncNever, fmt.Errorf("unknown fsync policy %q", name)
+}
+
+// Sync 将当前文件的内容刷入磁盘
+func (l *Logger) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sync()
+}
+
+// sync 刷盘，调用方需要持有锁
+func (l *Logger) sync() error {
+	if l.file == nil {
+		return nil
+	}
+	l.unsynced = 0
+	return l.file.Sync()
+}
+
+// writeFile 写入当前文件，并根据刷盘策略决定是否刷盘
+func (l *Logger) writeFile(p []byte) (int, error) {
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+	l.stats.BytesWritten += int64(n)
+	l.lines += int64(bytes.Count(p[:n], []byte{'\n'}))
+	if n > 0 {
+		now := l.now()
+		if l.firstWrite.IsZero() {
+			l.firstWrite = now
+		}
+		l.lastWrite = now
+	}
+	if err != nil {
+		return n, err
+	}
+
+	switch l.FsyncPolicy {
+	case FsyncEveryWrite:
+		err = l.sync()
+	case FsyncEveryBytes:
+		l.unsynced += int64(n)
+		if l.unsynced >= l.FsyncBytes {
+			err = l.sync()
+		}
+	case FsyncEveryInterval:
+		l.unsynced += int64(n)
+		l.startSyncLoop()
+	}
+	return n, err
+}
+
+// startSyncLoop 启动定时刷盘的goroutine，调用方需要持有锁
+func (l *Logger) startSyncLoop() {
+	if l.syncStop != nil {
+		return
+	}
+	interval := l.FsyncInterval
+	if interval <= 0 {
+		interval = defaultFsyncInterval
+	}
+	stop := make(chan struct{})
+	l.syncStop = stop
+
+	ticks, stopTicker := l.newTicker(interval)
+	go func() {
+		defer stopTicker()
+		for {
+			select {
+			case <-ticks:
+				l.mu.Lock()
+				if l.unsynced > 0 {
+					_ = l.sync()
+				}
+				l.mu.Unlock()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// stopSyncLoop 停止定时刷盘的goroutine，调用方需要持有锁
+func (l *Logger) stopSyncLoop() {
+	if l.syncStop == nil {
+		return
+	}
+	close(l.syncStop)
+	l.syncStop = nil
+}
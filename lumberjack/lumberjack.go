@@ -1,6 +1,7 @@
 package lumberjack
 
 import (
+	"bytes"
 	"compress/gzip"
 	"errors"
 	"fmt"
@@ -17,48 +18,142 @@ import (
 const (
 	backupTimeFormat = "2006-01-02T15-04-05.000"
 	compressSuffix   = ".gz"
+	tempSuffix       = ".tmp"
 	defaultMaxSize   = 100
+	defaultFileMode  = os.FileMode(0644)
+	defaultDirMode   = os.FileMode(0744)
+	truncateMarker   = "...[truncated]\n"
 )
 
-// ensure we always implement io.WriteCloser
-var _ io.WriteCloser = (*Logger)(nil)
+// OversizePolicy 单条写入超过MaxSize时的处理策略
+type OversizePolicy int
 
-func chown(_ string, _ os.FileInfo) error {
-	return nil
+const (
+	// OversizeReject 拒绝写入并返回错误（默认）
+	OversizeReject OversizePolicy = iota
+	// OversizeAllow 将整条内容写入一个新文件，允许该文件超过MaxSize
+	OversizeAllow
+	// OversizeTruncate 截断内容，并在末尾追加截断标记
+	OversizeTruncate
+	// OversizeSplit 将内容拆分写入多个文件
+	OversizeSplit
+)
+
+// String 返回策略名称
+func (p OversizePolicy) String() string {
+	switch p {
+	case OversizeReject:
+		return "reject"
+	case OversizeAllow:
+		return "allow"
+	case OversizeTruncate:
+		return "truncate"
+	case OversizeSplit:
+		return "split"
+	}
+	return fmt.Sprintf("OversizePolicy(%d)", int(p))
 }
 
+// ParseOversizePolicy 根据名称解析策略，空字符串表示OversizeReject
+func ParseOversizePolicy(name string) (OversizePolicy, error) {
+	switch strings.ToLower(name) {
+	case "", "reject":
+		return OversizeReject, nil
+	case "allow":
+		return OversizeAllow, nil
+	case "truncate":
+		return OversizeTruncate, nil
+	case "split":
+		return OversizeSplit, nil
+	}
+	return OversizeReject, fmt.Errorf("unknown oversize policy %q", name)
+}
+
+// OversizeCounts 各种超大写入处理方式的计数
+type OversizeCounts struct {
+	Rejected  int64 `json:"rejected"`  // 被拒绝的次数
+	Allowed   int64 `json:"allowed"`   // 整条写入新文件的次数
+	Truncated int64 `json:"truncated"` // 被截断的次数
+	Split     int64 `json:"split"`     // 被拆分的次数
+}
+
+// ensure we always implement io.WriteCloser
+var _ io.WriteCloser = (*Logger)(nil)
+
 type Logger struct {
 	Filename   string `json:"filename" yaml:"filename"`     // 文件名
 	MaxSize    int    `json:"maxsize" yaml:"maxsize"`       // 最大容量（M）
+	MaxLines   int    `json:"maxlines" yaml:"maxlines"`     // 每个文件最多的日志行数，0表示不限制
 	MaxAge     int    `json:"maxage" yaml:"maxage"`         // 最大数量
 	MaxBackups int    `json:"maxbackups" yaml:"maxbackups"` // 最大备份数量
 	LocalTime  bool   `json:"localtime" yaml:"localtime"`   // 本地时间
 	Compress   bool   `json:"compress" yaml:"compress"`     // 是否压缩
 
-	size int64
-	file *os.File
-	mu   sync.Mutex
+	Oversize       OversizePolicy `json:"oversize" yaml:"oversize"`             // 单条写入超过MaxSize时的处理策略
+	TruncateMarker string         `json:"truncatemarker" yaml:"truncatemarker"` // 截断标记，默认为"...[truncated]\n"
+
+	RotateOnStartup bool          `json:"rotateonstartup" yaml:"rotateonstartup"` // 进程启动后首次写入时总是创建新文件
+	Header          func() []byte `json:"-" yaml:"-"`                             // 每个新文件开头写入的内容
+
+	BackupDir string `json:"backupdir" yaml:"backupdir"` // 备份目录，默认与日志文件相同，可以位于其他挂载点
+
+	Clock Clock `json:"-" yaml:"-"` // 时间来源，默认为系统时间，可以使用core.Clock或者clock.Clock
+
+	MillConcurrency    int   `json:"millconcurrency" yaml:"millconcurrency"`       // 同时压缩和删除备份的最大并发数，默认为1
+	MillBytesPerSecond int64 `json:"millbytespersecond" yaml:"millbytespersecond"` // 压缩和删除备份每秒最多处理的字节数，0表示不限制
+	CompressAfter      int   `json:"compressafter" yaml:"compressafter"`           // 最近的N个备份不压缩
+
+	Manifest     bool   `json:"manifest" yaml:"manifest"`         // 是否在日志目录中维护备份清单
+	ManifestName string `json:"manifestname" yaml:"manifestname"` // 备份清单文件名，默认为"<文件名>.manifest.jsonl"
+
+	FsyncPolicy   FsyncPolicy   `json:"fsyncpolicy" yaml:"fsyncpolicy"`     // 刷盘策略
+	FsyncBytes    int64         `json:"fsyncbytes" yaml:"fsyncbytes"`       // FsyncEveryBytes策略下，每写入多少字节刷盘一次
+	FsyncInterval time.Duration `json:"fsyncinterval" yaml:"fsyncinterval"` // FsyncEveryInterval策略下的刷盘间隔
+
+	FileMode os.FileMode `json:"filemode" yaml:"filemode"` // 日志文件权限，默认沿用已有文件的权限或0644
+	DirMode  os.FileMode `json:"dirmode" yaml:"dirmode"`   // 新建日志目录的权限，默认0744
+	Owner    string      `json:"owner" yaml:"owner"`       // 日志文件所属用户，用户名或uid，为空时不修改
+	Group    string      `json:"group" yaml:"group"`       // 日志文件所属用户组，组名或gid，为空时不修改
+
+	started bool
+
+	size      int64
+	headerLen int64 // 当前文件开头文件头的长度，只有文件头的文件视为空文件
+	lines     int64 // 当前文件的行数
+	file      *os.File
+	mu        sync.Mutex
+	oversize  OversizeCounts
+	stats     Stats // 写入相关的统计，受mu保护
+
+	firstWrite time.Time       // 当前文件第一次写入的时间
+	lastWrite  time.Time       // 当前文件最后一次写入的时间
+	pending    []ManifestEntry // 等待mill写入清单的备份
+
+	millMu    sync.Mutex
+	millStats Stats // mill相关的统计，受millMu保护
+
+	unsynced int64         // 上次刷盘后写入的字节数
+	syncStop chan struct{} // 关闭时停止定时刷盘
 
 	millCh    chan bool
 	startMill sync.Once
+	recovered bool // 只在mill goroutine中访问
 }
 
 var (
-	currentTime = time.Now // 当前时间
-	os_Stat     = os.Stat
-	megabyte    = 1024 * 1024 // M，MaxSize的单位
+	os_Stat  = os.Stat
+	megabyte = 1024 * 1024 // M，MaxSize的单位
 )
 
 // Write 写入日志
 func (l *Logger) Write(p []byte) (n int, err error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	l.stats.Writes++
 
 	writeLen := int64(len(p))
 	if writeLen > l.max() {
-		return 0, fmt.Errorf(
-			"write length %d exceeds maximum file size %d", writeLen, l.max(),
-		)
+		return l.writeOversize(p)
 	}
 
 	if l.file == nil {
@@ -67,18 +162,106 @@ func (l *Logger) Write(p []byte) (n int, err error) {
 		}
 	}
 
-	if l.size+writeLen > l.max() {
+	if (l.size > l.headerLen && l.size+writeLen > l.max()) || l.exceedsLines(p) {
 		if err := l.rotate(); err != nil {
 			return 0, err
 		}
 	}
 
-	n, err = l.file.Write(p)
-	l.size += int64(n)
+	n, err = l.writeFile(p)
 
 	return n, err
 }
 
+// writeOversize 按照Oversize策略写入超过MaxSize的内容
+func (l *Logger) writeOversize(p []byte) (n int, err error) {
+	switch l.Oversize {
+	case OversizeAllow:
+		l.oversize.Allowed++
+		if err = l.openFresh(); err != nil {
+			return 0, err
+		}
+		n, err = l.writeFile(p)
+		return n, err
+	case OversizeTruncate:
+		l.oversize.Truncated++
+		if err = l.openFresh(); err != nil {
+			return 0, err
+		}
+		marker := l.TruncateMarker
+		if marker == "" {
+			marker = truncateMarker
+		}
+		room := l.room()
+		keep := room - int64(len(marker))
+		if keep < 0 {
+			keep = 0
+			marker = marker[:room]
+		}
+		buf := make([]byte, 0, keep+int64(len(marker)))
+		buf = append(buf, p[:keep]...)
+		buf = append(buf, marker...)
+		_, err = l.writeFile(buf)
+		if err != nil {
+			return 0, err
+		}
+		// 截断部分视为已处理，调用方不需要重试
+		return len(p), nil
+	case OversizeSplit:
+		l.oversize.Split++
+		for len(p) > 0 {
+			if err = l.openFresh(); err != nil {
+				return n, err
+			}
+			chunk := p
+			if room := l.room(); int64(len(chunk)) > room {
+				chunk = chunk[:room]
+			}
+			written, err := l.writeFile(chunk)
+			n += written
+			if err != nil {
+				return n, err
+			}
+			p = p[written:]
+		}
+		return n, nil
+	default:
+		l.oversize.Rejected++
+		return 0, fmt.Errorf(
+			"write length %d exceeds maximum file size %d", len(p), l.max(),
+		)
+	}
+}
+
+// openFresh 确保当前文件除文件头外为空，必要时先打开或备份已有文件
+func (l *Logger) openFresh() error {
+	if l.file == nil {
+		if err := l.openExistingOrNew(0); err != nil {
+			return err
+		}
+	}
+	if l.size > l.headerLen {
+		return l.rotate()
+	}
+	return nil
+}
+
+// room 返回当前文件除文件头外最多可写入的字节数
+func (l *Logger) room() int64 {
+	if room := l.max() - l.headerLen; room > 0 {
+		return room
+	}
+	// 文件头本身超过MaxSize时无法满足限制，按MaxSize写入
+	return l.max()
+}
+
+// Oversized 返回超大写入的处理计数
+func (l *Logger) Oversized() OversizeCounts {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.oversize
+}
+
 // Close 关闭
 func (l *Logger) Close() error {
 	l.mu.Lock()
@@ -91,7 +274,14 @@ func (l *Logger) close() error {
 	if l.file == nil {
 		return nil
 	}
-	err := l.file.Close()
+	l.stopSyncLoop()
+	var err error
+	if l.FsyncPolicy != FsyncNever {
+		err = l.sync()
+	}
+	if errClose := l.file.Close(); err == nil {
+		err = errClose
+	}
 	l.file = nil
 	return err
 }
@@ -117,25 +307,39 @@ func (l *Logger) rotate() error {
 
 // openNew 打开新的文件句柄
 func (l *Logger) openNew() error {
-	err := os.MkdirAll(l.dir(), 0744)
+	err := l.makeDir(l.dir())
 	if err != nil {
 		return fmt.Errorf("can't make directories for new logfile: %s", err)
 	}
 
 	name := l.filename()
-	mode := os.FileMode(0644)
+	mode := l.fileMode()
 	info, err := os_Stat(name)
 	if err == nil {
-		// 复制文件的模式
-		mode = info.Mode()
+		// 没有指定权限时复制文件的模式
+		if l.FileMode == 0 {
+			mode = info.Mode()
+		}
 
 		// 复制文件
-		newname := backupName(name, l.LocalTime)
-		if err := os.Rename(name, newname); err != nil {
+		if err := l.makeDir(l.backupDir()); err != nil {
+			return fmt.Errorf("can't make directories for backup logfile: %s", err)
+		}
+		newname := backupName(name, l.backupDir(), l.now(), l.LocalTime)
+		if err := moveFile(name, newname); err != nil {
 			return fmt.Errorf("修改日志文件名失败: %s", err)
 		}
+		l.stats.Rotations++
+		l.stats.LastRotation = l.now()
+		if l.Manifest {
+			l.pending = append(l.pending, ManifestEntry{
+				Name:       filepath.Base(newname),
+				FirstEntry: l.firstWrite,
+				LastEntry:  l.lastWrite,
+			})
+		}
 
-		// 修改文件的权限
+		// 保留原文件的所有者
 		if err := chown(name, info); err != nil {
 			return err
 		}
@@ -148,30 +352,60 @@ func (l *Logger) openNew() error {
 	if err != nil {
 		return fmt.Errorf("can't open new logfile: %s", err)
 	}
+	if err := l.applyPerm(f, name); err != nil {
+		f.Close()
+		return err
+	}
 	l.file = f
 	l.size = 0
+	l.headerLen = 0
+	l.lines = 0
+	l.firstWrite = time.Time{}
+	l.lastWrite = time.Time{}
+
+	// 写入文件头，使每个文件都能自我描述
+	if l.Header != nil {
+		if header := l.Header(); len(header) > 0 {
+			n, err := f.Write(header)
+			l.size += int64(n)
+			l.headerLen = int64(n)
+			if err != nil {
+				return fmt.Errorf("can't write logfile header: %s", err)
+			}
+		}
+	}
 	return nil
 }
 
-// backupName 备份名
-func backupName(name string, local bool) string {
-	dir := filepath.Dir(name)
+// backupName 备份名，备份文件位于dir目录中，以t作为备份时间
+func backupName(name, dir string, t time.Time, local bool) string {
 	filename := filepath.Base(name)
 	ext := filepath.Ext(filename)
 	prefix := filename[:len(filename)-len(ext)]
-	t := currentTime()
 	if !local {
 		t = t.UTC()
 	}
 
-	timestamp := t.Format(backupTimeFormat)
-	return filepath.Join(dir, fmt.Sprintf("%s-%s%s", prefix, timestamp, ext))
+	// 同一毫秒内多次备份（例如拆分超大写入）时，顺延时间戳避免覆盖已有备份
+	for {
+		timestamp := t.Format(backupTimeFormat)
+		newname := filepath.Join(dir, fmt.Sprintf("%s-%s%s", prefix, timestamp, ext))
+		if _, err := os_Stat(newname); os.IsNotExist(err) {
+			if _, err := os_Stat(newname + compressSuffix); os.IsNotExist(err) {
+				return newname
+			}
+		}
+		t = t.Add(time.Millisecond)
+	}
 }
 
 // openExistingOrNew 打开已存在的或者创建新的
 func (l *Logger) openExistingOrNew(writeLen int) error {
 	l.mill()
 
+	startup := !l.started
+	l.started = true
+
 	filename := l.filename()
 	info, err := os_Stat(filename)
 	if os.IsNotExist(err) {
@@ -181,21 +415,68 @@ func (l *Logger) openExistingOrNew(writeLen int) error {
 		return fmt.Errorf("error getting log file info: %s", err)
 	}
 
+	headerLen := l.existingHeaderLen(info.Size())
+
+	// 启动后第一次打开时，不再追加到上一次运行的文件中
+	if l.RotateOnStartup && startup {
+		if info.Size() > headerLen {
+			return l.rotate()
+		}
+		// 空文件或只有文件头的文件不需要备份，直接重新创建以写入文件头
+		if err := os.Remove(filename); err != nil {
+			return fmt.Errorf("can't remove empty logfile: %s", err)
+		}
+		return l.openNew()
+	}
+
 	if info.Size()+int64(writeLen) >= l.max() {
 		return l.rotate()
 	}
 
-	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+	// 按行数备份时需要知道已有文件的行数
+	var lines int64
+	if l.MaxLines > 0 {
+		if lines, err = l.countLines(filename); err != nil {
+			return l.openNew()
+		}
+		if lines >= int64(l.MaxLines) {
+			return l.rotate()
+		}
+	}
+
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, l.fileMode())
 	if err != nil {
 		// if we fail to open the old log file for some reason, just ignore
 		// it and open a new log file.
 		return l.openNew()
 	}
+	// 追加到已有文件时同样使用配置的权限和所有者
+	if err := l.applyPerm(file, filename); err != nil {
+		file.Close()
+		return err
+	}
 	l.file = file
 	l.size = info.Size()
+	l.headerLen = headerLen
+	l.lines = lines
+	l.firstWrite = time.Time{}
+	l.lastWrite = info.ModTime()
 	return nil
 }
 
+// existingHeaderLen 返回已有文件开头文件头的长度。
+// 文件头按当前Header的长度计算，因此要求文件头的长度固定。
+func (l *Logger) existingHeaderLen(size int64) int64 {
+	if l.Header == nil {
+		return 0
+	}
+	n := int64(len(l.Header()))
+	if n > size {
+		return 0
+	}
+	return n
+}
+
 // genFilename generates the name of the logfile from the current time.
 func (l *Logger) filename() string {
 	if l.Filename != "" {
@@ -210,7 +491,12 @@ func (l *Logger) filename() string {
 // files are removed, keeping at most l.MaxBackups files, as long as
 // none of them are older than MaxAge.
 func (l *Logger) millRunOnce() error {
-	if l.MaxBackups == 0 && l.MaxAge == 0 && !l.Compress {
+	if !l.recovered {
+		l.recovered = true
+		_ = l.recoverCompression()
+	}
+
+	if l.MaxBackups == 0 && l.MaxAge == 0 && !l.Compress && !l.Manifest {
 		return nil
 	}
 
@@ -243,7 +529,7 @@ func (l *Logger) millRunOnce() error {
 	}
 	if l.MaxAge > 0 {
 		diff := time.Duration(int64(24*time.Hour) * int64(l.MaxAge))
-		cutoff := currentTime().Add(-1 * diff)
+		cutoff := l.now().Add(-1 * diff)
 
 		var remaining []logInfo
 		for _, f := range files {
@@ -257,24 +543,39 @@ func (l *Logger) millRunOnce() error {
 	}
 
 	if l.Compress {
-		for _, f := range files {
+		for i, f := range files {
+			// 最近的CompressAfter个备份保持未压缩，方便直接grep
+			if i < l.CompressAfter {
+				continue
+			}
 			if !strings.HasSuffix(f.Name(), compressSuffix) {
 				compress = append(compress, f)
 			}
 		}
 	}
 
+	limiter := newRateLimiter(l.MillBytesPerSecond, l.now, l.sleep)
+	tasks := make([]func() error, 0, len(remove)+len(compress))
 	for _, f := range remove {
-		errRemove := os.Remove(filepath.Join(l.dir(), f.Name()))
-		if err == nil && errRemove != nil {
-			err = errRemove
-		}
+		f := f
+		tasks = append(tasks, func() error {
+			limiter.wait(f.Size())
+			return os.Remove(filepath.Join(l.backupDir(), f.Name()))
+		})
 	}
 	for _, f := range compress {
-		fn := filepath.Join(l.dir(), f.Name())
-		errCompress := compressLogFile(fn, fn+compressSuffix)
-		if err == nil && errCompress != nil {
-			err = errCompress
+		fn := filepath.Join(l.backupDir(), f.Name())
+		tasks = append(tasks, func() error {
+			return compressLogFile(fn, fn+compressSuffix, limiter)
+		})
+	}
+	if errTasks := runTasks(tasks, l.MillConcurrency); err == nil {
+		err = errTasks
+	}
+
+	if l.Manifest {
+		if errManifest := l.updateManifest(); err == nil {
+			err = errManifest
 		}
 	}
 
@@ -286,7 +587,7 @@ func (l *Logger) millRunOnce() error {
 func (l *Logger) millRun() {
 	for _ = range l.millCh {
 		// what am I going to do, log this?
-		_ = l.millRunOnce()
+		l.millRunStats()
 	}
 }
 
@@ -303,10 +604,13 @@ func (l *Logger) mill() {
 	}
 }
 
-// oldLogFiles returns the list of backup log files stored in the same
-// directory as the current log file, sorted by ModTime
+// oldLogFiles returns the list of backup log files stored in the backup
+// directory, sorted by ModTime
 func (l *Logger) oldLogFiles() ([]logInfo, error) {
-	files, err := ioutil.ReadDir(l.dir())
+	files, err := ioutil.ReadDir(l.backupDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("can't read log file directory: %s", err)
 	}
@@ -349,6 +653,39 @@ func (l *Logger) timeFromName(filename, prefix, ext string) (time.Time, error) {
 	return time.Parse(backupTimeFormat, ts)
 }
 
+// countLines 统计已有文件中日志的行数，与写入时的计数一致，不包括文件头
+//
+// 文件头按当前Header的换行符个数扣除，因此要求文件头的行数固定。
+func (l *Logger) countLines(name string) (int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	lines := &lineCounter{}
+	if _, err := io.Copy(lines, f); err != nil {
+		return 0, err
+	}
+	n := lines.n
+	if l.Header != nil {
+		n -= int64(bytes.Count(l.Header(), []byte{'\n'}))
+	}
+	if n < 0 {
+		n = 0
+	}
+	return n, nil
+}
+
+// exceedsLines reports whether writing p would take the current file past
+// MaxLines. An empty file always accepts the write.
+func (l *Logger) exceedsLines(p []byte) bool {
+	if l.MaxLines <= 0 || l.lines == 0 {
+		return false
+	}
+	return l.lines+int64(bytes.Count(p, []byte{'\n'})) > int64(l.MaxLines)
+}
+
 // max returns the maximum size in bytes of log files before rolling.
 func (l *Logger) max() int64 {
 	if l.MaxSize == 0 {
@@ -357,11 +694,59 @@ func (l *Logger) max() int64 {
 	return int64(l.MaxSize) * int64(megabyte)
 }
 
+// fileMode returns the permission bits used for new log files.
+func (l *Logger) fileMode() os.FileMode {
+	if l.FileMode != 0 {
+		return l.FileMode
+	}
+	return defaultFileMode
+}
+
+// dirMode returns the permission bits used for new log directories.
+func (l *Logger) dirMode() os.FileMode {
+	if l.DirMode != 0 {
+		return l.DirMode
+	}
+	return defaultDirMode
+}
+
+// applyPerm 设置日志文件的权限和所有者。
+// 创建文件时的权限会受umask影响，指定了权限时需要显式修改。
+func (l *Logger) applyPerm(f *os.File, name string) error {
+	if l.FileMode != 0 {
+		if err := f.Chmod(l.FileMode); err != nil {
+			return fmt.Errorf("can't chmod logfile: %s", err)
+		}
+	}
+	return l.setOwner(name)
+}
+
+// makeDir 创建目录，指定了DirMode时新建的目录不受umask影响。
+// 已有的目录保持原有权限。
+func (l *Logger) makeDir(dir string) error {
+	_, statErr := os_Stat(dir)
+	if err := os.MkdirAll(dir, l.dirMode()); err != nil {
+		return err
+	}
+	if l.DirMode != 0 && os.IsNotExist(statErr) {
+		return os.Chmod(dir, l.DirMode)
+	}
+	return nil
+}
+
 // dir returns the directory for the current filename.
 func (l *Logger) dir() string {
 	return filepath.Dir(l.filename())
 }
 
+// backupDir returns the directory where rotated log files are stored.
+func (l *Logger) backupDir() string {
+	if l.BackupDir != "" {
+		return l.BackupDir
+	}
+	return l.dir()
+}
+
 // prefixAndExt returns the filename part and extension part from the Logger's
 // filename.
 func (l *Logger) prefixAndExt() (prefix, ext string) {
@@ -371,9 +756,56 @@ func (l *Logger) prefixAndExt() (prefix, ext string) {
 	return prefix, ext
 }
 
+// moveFile renames src to dst. When they are on different filesystems, the
+// file is copied and the source removed instead.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	if linkErr, ok := err.(*os.LinkError); !ok || !isCrossDevice(linkErr.Err) {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, fi.Mode())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
+
 // compressLogFile compresses the given log file, removing the
 // uncompressed log file if successful.
-func compressLogFile(src, dst string) (err error) {
+//
+// The archive is first written to a temporary file, synced and verified,
+// then renamed into place. The source is only removed after the rename, so a
+// crash at any point leaves either the original or a complete archive.
+func compressLogFile(src, dst string, limiter *rateLimiter) (err error) {
 	f, err := os.Open(src)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %v", err)
@@ -385,13 +817,14 @@ func compressLogFile(src, dst string) (err error) {
 		return fmt.Errorf("failed to stat log file: %v", err)
 	}
 
-	if err := chown(dst, fi); err != nil {
+	tmp := dst + tempSuffix
+	if err := chown(tmp, fi); err != nil {
 		return fmt.Errorf("failed to chown compressed log file: %v", err)
 	}
 
 	// If this file already exists, we presume it was created by
 	// a previous attempt to compress the log file.
-	gzf, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fi.Mode())
+	gzf, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fi.Mode())
 	if err != nil {
 		return fmt.Errorf("failed to open compressed log file: %v", err)
 	}
@@ -401,20 +834,31 @@ func compressLogFile(src, dst string) (err error) {
 
 	defer func() {
 		if err != nil {
-			os.Remove(dst)
+			gzf.Close()
+			os.Remove(tmp)
 			err = fmt.Errorf("failed to compress log file: %v", err)
 		}
 	}()
 
-	if _, err := io.Copy(gz, f); err != nil {
+	if _, err := io.Copy(gz, limiter.reader(f)); err != nil {
 		return err
 	}
 	if err := gz.Close(); err != nil {
 		return err
 	}
+	if err := gzf.Sync(); err != nil {
+		return err
+	}
 	if err := gzf.Close(); err != nil {
 		return err
 	}
+	if err := verifyGzip(tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(dst))
 
 	if err := f.Close(); err != nil {
 		return err
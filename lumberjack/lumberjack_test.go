@@ -0,0 +1,370 @@
+package lumberjack
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_log/clock"
+	"github.com/zhangdapeng520/zdpgo_log/core"
+)
+
+var (
+	_ Clock = core.DefaultClock
+	_ Clock = clock.New()
+)
+
+// 测试使用模拟时钟生成备份文件名
+func TestLogger_ClockBackupName(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	mock := clock.NewMock()
+	mock.Set(time.Date(2022, 1, 2, 3, 4, 5, 6e6, time.UTC))
+
+	l := &Logger{Filename: filepath.Join(dir, "a.log"), Clock: mock}
+	defer l.Close()
+	if _, err := l.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "a-2022-01-02T03-04-05.006.log")); err != nil {
+		t.Fatalf("backup not named after mock time: %v", err)
+	}
+	if got := l.Stats().LastRotation; !got.Equal(mock.Now()) {
+		t.Fatalf("LastRotation = %v, want %v", got, mock.Now())
+	}
+}
+
+// 测试使用模拟时钟按照MaxAge清理备份
+func TestLogger_ClockMaxAge(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	mock := clock.NewMock()
+	mock.Set(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	l := &Logger{Filename: filepath.Join(dir, "a.log"), MaxAge: 1, Clock: mock}
+	defer l.Close()
+	l.Write([]byte("day one\n"))
+	if err := l.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	old := filepath.Join(dir, "a-2022-01-01T00-00-00.000.log")
+	waitFor(t, func() bool { _, err := os.Stat(old); return err == nil })
+
+	mock.Add(3 * 24 * time.Hour)
+	l.Write([]byte("day four\n"))
+	if err := l.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { _, err := os.Stat(old); return os.IsNotExist(err) })
+	if _, err := os.Stat(filepath.Join(dir, "a-2022-01-04T00-00-00.000.log")); err != nil {
+		t.Fatalf("recent backup removed: %v", err)
+	}
+}
+
+// waitFor 等待后台mill完成
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// 测试单条写入超过MaxSize时的各种处理策略及其计数
+func TestLogger_Oversize(t *testing.T) {
+	defer func(old int) { megabyte = old }(megabyte)
+	megabyte = 1
+
+	tests := []struct {
+		policy  OversizePolicy
+		wantN   int
+		wantErr bool
+		current string // 写入后当前文件的内容
+		total   int    // 目录中所有文件的字节数
+		counts  OversizeCounts
+	}{
+		{OversizeReject, 0, true, "", 0, OversizeCounts{Rejected: 1}},
+		{OversizeAllow, 25, false, "0123456789abcdefghijklmno", 25, OversizeCounts{Allowed: 1}},
+		{OversizeTruncate, 25, false, "012345678~", 10, OversizeCounts{Truncated: 1}},
+		{OversizeSplit, 25, false, "klmno", 25, OversizeCounts{Split: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			dir := t.TempDir()
+			filename := filepath.Join(dir, "a.log")
+			l := &Logger{Filename: filename, MaxSize: 10, Oversize: tt.policy, TruncateMarker: "~"}
+			defer l.Close()
+
+			n, err := l.Write([]byte("0123456789abcdefghijklmno"))
+			if (err != nil) != tt.wantErr || n != tt.wantN {
+				t.Fatalf("Write() = %d, %v; want %d, error %v", n, err, tt.wantN, tt.wantErr)
+			}
+			if got := l.Oversized(); got != tt.counts {
+				t.Errorf("Oversized() = %+v, want %+v", got, tt.counts)
+			}
+			if data, _ := os.ReadFile(filename); string(data) != tt.current {
+				t.Errorf("current file = %q, want %q", data, tt.current)
+			}
+			total := 0
+			files, _ := os.ReadDir(dir)
+			for _, f := range files {
+				info, err := f.Info()
+				if err != nil {
+					t.Fatal(err)
+				}
+				total += int(info.Size())
+			}
+			if total != tt.total {
+				t.Errorf("%d bytes in %d files, want %d", total, len(files), tt.total)
+			}
+		})
+	}
+}
+
+// 测试重新打开已有文件时的行数与写入时的计数一致，不包括文件头
+func TestLogger_MaxLinesReopenWithHeader(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "a.log")
+	header := func() []byte { return []byte("# header\n") }
+
+	l := &Logger{Filename: filename, MaxLines: 3, Header: header}
+	l.Write([]byte("one\n"))
+	l.Write([]byte("two\n"))
+	l.Close()
+
+	l = &Logger{Filename: filename, MaxLines: 3, Header: header}
+	defer l.Close()
+	l.Write([]byte("three\n"))
+	if data, _ := os.ReadFile(filename); string(data) != "# header\none\ntwo\nthree\n" {
+		t.Fatalf("rotated before MaxLines, current file = %q", data)
+	}
+	l.Write([]byte("four\n"))
+	if data, _ := os.ReadFile(filename); string(data) != "# header\nfour\n" {
+		t.Fatalf("not rotated after MaxLines, current file = %q", data)
+	}
+}
+
+// 测试有文件头时超大写入不会备份只有文件头的文件，拆分和截断后的文件也不超过MaxSize
+func TestLogger_OversizeWithHeader(t *testing.T) {
+	defer func(old int) { megabyte = old }(megabyte)
+	megabyte = 1
+
+	tests := []struct {
+		policy  OversizePolicy
+		current string // 写入后当前文件的内容
+		files   int    // 目录中的文件数
+		total   int    // 目录中所有文件的字节数
+	}{
+		{OversizeAllow, "#\n0123456789abcdefghijklmno", 1, 27},
+		{OversizeTruncate, "#\n0123456~", 1, 10},
+		{OversizeSplit, "#\no", 4, 33},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			dir := t.TempDir()
+			filename := filepath.Join(dir, "a.log")
+			l := &Logger{
+				Filename:       filename,
+				MaxSize:        10,
+				Oversize:       tt.policy,
+				TruncateMarker: "~",
+				Header:         func() []byte { return []byte("#\n") },
+			}
+			defer l.Close()
+
+			if n, err := l.Write([]byte("0123456789abcdefghijklmno")); err != nil || n != 25 {
+				t.Fatalf("Write() = %d, %v", n, err)
+			}
+			if data, _ := os.ReadFile(filename); string(data) != tt.current {
+				t.Errorf("current file = %q, want %q", data, tt.current)
+			}
+			files, _ := os.ReadDir(dir)
+			total := 0
+			for _, f := range files {
+				info, err := f.Info()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tt.policy != OversizeAllow && info.Size() > 10 {
+					t.Errorf("%s has %d bytes, more than MaxSize", f.Name(), info.Size())
+				}
+				total += int(info.Size())
+			}
+			if len(files) != tt.files || total != tt.total {
+				t.Errorf("%d bytes in %d files, want %d in %d", total, len(files), tt.total, tt.files)
+			}
+		})
+	}
+}
+
+// 测试启动时备份上一次运行的文件，空文件和只有文件头的文件不备份
+func TestLogger_RotateOnStartup(t *testing.T) {
+	tests := []struct {
+		name    string
+		existed string // 启动前文件的内容
+		backups int
+	}{
+		{"with entries", "#\nold\n", 1},
+		{"header only", "#\n", 0},
+		{"empty", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			filename := filepath.Join(dir, "a.log")
+			if err := os.WriteFile(filename, []byte(tt.existed), 0644); err != nil {
+				t.Fatal(err)
+			}
+			l := &Logger{
+				Filename:        filename,
+				RotateOnStartup: true,
+				Header:          func() []byte { return []byte("#\n") },
+			}
+			l.Write([]byte("new\n"))
+			// 关闭后再次写入时追加到当前文件，不再备份
+			l.Close()
+			l.Write([]byte("again\n"))
+			l.Close()
+
+			if data, _ := os.ReadFile(filename); string(data) != "#\nnew\nagain\n" {
+				t.Errorf("current file = %q", data)
+			}
+			files, _ := os.ReadDir(dir)
+			if len(files)-1 != tt.backups {
+				t.Errorf("%d backups, want %d", len(files)-1, tt.backups)
+			}
+		})
+	}
+}
+
+// 测试追加到已有文件时也使用配置的权限和所有者，新建的目录不受umask影响
+func TestLogger_PermissionsOnReopen(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes aren't supported on Windows")
+	}
+	dir := filepath.Join(t.TempDir(), "logs")
+	filename := filepath.Join(dir, "a.log")
+
+	l := &Logger{Filename: filename, DirMode: 0777}
+	l.Write([]byte("one\n"))
+	l.Close()
+	if info, err := os.Stat(dir); err != nil || info.Mode().Perm() != 0777 {
+		t.Fatalf("dir mode = %v, %v; want 0777", info.Mode().Perm(), err)
+	}
+	if err := os.Chmod(filename, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	l = &Logger{Filename: filename, FileMode: 0640}
+	l.Write([]byte("two\n"))
+	l.Close()
+	if info, err := os.Stat(filename); err != nil || info.Mode().Perm() != 0640 {
+		t.Fatalf("file mode = %v, %v; want 0640", info.Mode().Perm(), err)
+	}
+
+	l = &Logger{Filename: filename, Owner: "no-such-user-zdpgo"}
+	defer l.Close()
+	if _, err := l.Write([]byte("three\n")); err == nil {
+		t.Fatal("expected the unknown owner to be reported when reopening")
+	}
+}
+
+// 测试mill限速按照传入的时钟计算等待时间
+func TestRateLimiter_Clock(t *testing.T) {
+	mock := clock.NewMock()
+	var slept []time.Duration
+	r := newRateLimiter(100, mock.Now, func(d time.Duration) { slept = append(slept, d) })
+
+	r.wait(100)
+	r.wait(50)
+	r.wait(50)
+	want := []time.Duration{time.Second, 1500 * time.Millisecond}
+	if len(slept) != len(want) || slept[0] != want[0] || slept[1] != want[1] {
+		t.Fatalf("slept %v, want %v", slept, want)
+	}
+
+	// 时钟走过预留的时间后不再等待
+	mock.Add(2 * time.Second)
+	r.wait(50)
+	if len(slept) != 2 {
+		t.Fatalf("slept %v after the clock caught up", slept)
+	}
+}
+
+// 测试最近的CompressAfter个备份不压缩
+func TestLogger_CompressAfter(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	names := []string{
+		"a-2022-01-01T00-00-00.000.log",
+		"a-2022-01-02T00-00-00.000.log",
+		"a-2022-01-03T00-00-00.000.log",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("entry\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l := &Logger{Filename: filepath.Join(dir, "a.log"), Compress: true, CompressAfter: 2}
+	defer l.Close()
+	if err := l.millRunOnce(); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range names {
+		compressed := i == 0
+		if _, err := os.Stat(filepath.Join(dir, name+compressSuffix)); (err == nil) != compressed {
+			t.Errorf("%s: compressed = %v, want %v", name, err == nil, compressed)
+		}
+	}
+}
+
+// 测试mill任务的并发数不超过MillConcurrency
+func TestRunTasks_Concurrency(t *testing.T) {
+	var (
+		mu           sync.Mutex
+		running, max int
+	)
+	errFirst := errors.New("first")
+	tasks := make([]func() error, 8)
+	for i := range tasks {
+		i := i
+		tasks[i] = func() error {
+			mu.Lock()
+			running++
+			if running > max {
+				max = running
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			if i == 3 {
+				return errFirst
+			}
+			return nil
+		}
+	}
+	if err := runTasks(tasks, 3); err != errFirst {
+		t.Errorf("runTasks() = %v, want %v", err, errFirst)
+	}
+	if max > 3 {
+		t.Errorf("%d tasks ran at once, want at most 3", max)
+	}
+	if running != 0 {
+		t.Errorf("%d tasks still running after runTasks returned", running)
+	}
+}
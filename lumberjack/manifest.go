@@ -0,0 +1,212 @@
+package lumberjack
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// manifestSuffix 默认清单文件名的后缀
+const manifestSuffix = ".manifest.jsonl"
+
+// ManifestEntry 备份清单中的一条记录，对应一个备份文件
+type ManifestEntry struct {
+	Name       string    `json:"name"`        // 备份文件名，位于备份目录中
+	FirstEntry time.Time `json:"first_entry"` // 第一条日志的写入时间，未知时为零值
+	LastEntry  time.Time `json:"last_entry"`  // 最后一条日志的写入时间
+	Size       int64     `json:"size"`        // 备份文件大小
+	Lines      int64     `json:"lines"`       // 日志行数
+	SHA256     string    `json:"sha256"`      // 备份文件内容的SHA-256
+	Compressed bool      `json:"compressed"`  // 是否已经压缩
+}
+
+// ManifestPath 返回备份清单文件的路径
+func (l *Logger) ManifestPath() string {
+	if l.ManifestName != "" {
+		return filepath.Join(l.dir(), l.ManifestName)
+	}
+	filename := filepath.Base(l.filename())
+	ext := filepath.Ext(filename)
+	return filepath.Join(l.dir(), filename[:len(filename)-len(ext)]+manifestSuffix)
+}
+
+// ReadManifest 读取备份清单，同名的记录以最后一条为准
+func ReadManifest(name string) ([]ManifestEntry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []ManifestEntry
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var entry ManifestEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, fmt.Errorf("invalid manifest line %q: %v", line, err)
+		}
+		if i, ok := index[entry.Name]; ok {
+			entries[i] = entry
+			continue
+		}
+		index[entry.Name] = len(entries)
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// updateManifest 根据当前的备份文件重写备份清单
+//
+// 新备份的时间范围来自rotate时记录的数据，大小、行数和校验和由mill计算。
+// 已经删除的备份会从清单中移除，压缩后的备份继承原文件的时间范围和行数。
+func (l *Logger) updateManifest() error {
+	l.mu.Lock()
+	pending := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+
+	known := make(map[string]ManifestEntry)
+	entries, err := ReadManifest(l.ManifestPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, entry := range entries {
+		known[entry.Name] = entry
+	}
+	for _, entry := range pending {
+		known[entry.Name] = entry
+	}
+
+	files, err := l.oldLogFiles()
+	if err != nil {
+		return err
+	}
+
+	result := make([]ManifestEntry, 0, len(files))
+	for _, f := range files {
+		name := f.Name()
+		entry, ok := known[name]
+		if !ok && strings.HasSuffix(name, compressSuffix) {
+			entry, ok = known[strings.TrimSuffix(name, compressSuffix)]
+			entry.SHA256 = ""
+		}
+		entry.Name = name
+		entry.Compressed = strings.HasSuffix(name, compressSuffix)
+		if entry.LastEntry.IsZero() {
+			entry.LastEntry = f.timestamp
+		}
+
+		if entry.SHA256 == "" || entry.Size != f.Size() {
+			sum, lines, err := checksumFile(filepath.Join(l.backupDir(), name), entry.Compressed)
+			if err != nil {
+				// 文件可能刚刚被压缩或删除，下一次mill时再处理
+				continue
+			}
+			entry.SHA256 = sum
+			entry.Size = f.Size()
+			// 压缩文件的行数沿用压缩前的记录
+			if !entry.Compressed || !ok || entry.Lines == 0 {
+				entry.Lines = lines
+			}
+		}
+		result = append(result, entry)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastEntry.Before(result[j].LastEntry)
+	})
+	if err := writeManifest(l.ManifestPath(), result, l.fileMode()); err != nil {
+		return err
+	}
+	return l.setOwner(l.ManifestPath())
+}
+
+// checksumFile 计算文件的SHA-256和日志行数，compressed为true时统计解压后的行数
+func checksumFile(name string, compressed bool) (string, int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	lines := &lineCounter{}
+	if !compressed {
+		if _, err := io.Copy(io.MultiWriter(hash, lines), f); err != nil {
+			return "", 0, err
+		}
+		return hex.EncodeToString(hash.Sum(nil)), lines.n, nil
+	}
+
+	gz, err := gzip.NewReader(io.TeeReader(f, hash))
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := io.Copy(lines, gz); err != nil {
+		return "", 0, err
+	}
+	// 读完gzip数据后的剩余内容也要计入校验和
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), lines.n, nil
+}
+
+// writeManifest 原子地写入备份清单
+func writeManifest(name string, entries []ManifestEntry, mode os.FileMode) error {
+	tmp := name + tempSuffix
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return fmt.Errorf("can't open manifest: %s", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// lineCounter 统计写入内容中的换行符个数
+type lineCounter struct {
+	n int64
+}
+
+func (c *lineCounter) Write(p []byte) (int, error) {
+	c.n += int64(bytes.Count(p, []byte{'\n'}))
+	return len(p), nil
+}
@@ -0,0 +1,54 @@
+package lumberjack
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// setOwner changes the owner and group of name to the configured Owner and
+// Group. Unset values are left untouched.
+func (l *Logger) setOwner(name string) error {
+	if l.Owner == "" && l.Group == "" {
+		return nil
+	}
+	uid, gid, err := lookupOwner(l.Owner, l.Group)
+	if err != nil {
+		return err
+	}
+	if err := os.Chown(name, uid, gid); err != nil {
+		return fmt.Errorf("can't chown logfile: %s", err)
+	}
+	return nil
+}
+
+// lookupOwner resolves a user and group, given either as names or numeric
+// ids, to uid and gid. An empty value resolves to -1, which os.Chown leaves
+// unchanged.
+func lookupOwner(owner, group string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+	if owner != "" {
+		if uid, err = strconv.Atoi(owner); err != nil {
+			u, err := user.Lookup(owner)
+			if err != nil {
+				return -1, -1, fmt.Errorf("can't find log file owner %q: %s", owner, err)
+			}
+			if uid, err = strconv.Atoi(u.Uid); err != nil {
+				return -1, -1, fmt.Errorf("unsupported uid %q for user %q", u.Uid, owner)
+			}
+		}
+	}
+	if group != "" {
+		if gid, err = strconv.Atoi(group); err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return -1, -1, fmt.Errorf("can't find log file group %q: %s", group, err)
+			}
+			if gid, err = strconv.Atoi(g.Gid); err != nil {
+				return -1, -1, fmt.Errorf("unsupported gid %q for group %q", g.Gid, group)
+			}
+		}
+	}
+	return uid, gid, nil
+}
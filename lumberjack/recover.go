@@ -0,0 +1,93 @@
+package lumberjack
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// recoverCompression cleans up after a compression that was interrupted by
+// a crash. Leftover temporary archives are removed, since their source is
+// still present and will be compressed again. When both a backup and its
+// archive exist, the archive is kept if it is complete and the backup
+// removed; otherwise the broken archive is removed.
+func (l *Logger) recoverCompression() error {
+	files, err := ioutil.ReadDir(l.backupDir())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	prefix, ext := l.prefixAndExt()
+	names := make(map[string]bool, len(files))
+	for _, f := range files {
+		names[f.Name()] = true
+	}
+
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		fn := filepath.Join(l.backupDir(), name)
+
+		if strings.HasSuffix(name, ext+compressSuffix+tempSuffix) {
+			if errRemove := os.Remove(fn); err == nil && errRemove != nil {
+				err = errRemove
+			}
+			continue
+		}
+
+		if !strings.HasSuffix(name, ext) || !names[name+compressSuffix] {
+			continue
+		}
+		if _, errTime := l.timeFromName(name, prefix, ext); errTime != nil {
+			continue
+		}
+		if verifyGzip(fn+compressSuffix) == nil {
+			if errRemove := os.Remove(fn); err == nil && errRemove != nil {
+				err = errRemove
+			}
+		} else {
+			if errRemove := os.Remove(fn + compressSuffix); err == nil && errRemove != nil {
+				err = errRemove
+			}
+		}
+	}
+	return err
+}
+
+// verifyGzip reads the whole gzip stream in name, which checks its CRC and
+// length trailer.
+func verifyGzip(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(ioutil.Discard, gz); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// syncDir flushes directory metadata such as a rename to disk. Errors are
+// ignored because not every platform supports syncing a directory.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	d.Close()
+}
@@ -0,0 +1,69 @@
+package lumberjack
+
+import (
+	"time"
+)
+
+// Stats 日志文件的写入和备份统计
+type Stats struct {
+	Filename         string         `json:"filename"`           // 文件名
+	BytesWritten     int64          `json:"bytes_written"`      // 写入的字节数
+	Writes           int64          `json:"writes"`             // 调用Write的次数
+	Rotations        int64          `json:"rotations"`          // 备份次数
+	LastRotation     time.Time      `json:"last_rotation"`      // 最近一次备份的时间
+	FileSize         int64          `json:"file_size"`          // 当前文件大小
+	Backups          int            `json:"backups"`            // 备份文件个数
+	BackupBytes      int64          `json:"backup_bytes"`       // 备份文件总大小
+	LastMillDuration time.Duration  `json:"last_mill_duration"` // 最近一次压缩和清理的耗时
+	LastMillError    string         `json:"last_mill_error"`    // 最近一次压缩和清理的错误
+	Oversize         OversizeCounts `json:"oversize"`           // 超大写入的处理计数
+}
+
+// Stats 返回日志文件的统计信息
+//
+// 备份相关的数据在每次mill运行结束时更新。
+func (l *Logger) Stats() Stats {
+	l.mu.Lock()
+	stats := l.stats
+	stats.Filename = l.filename()
+	stats.FileSize = l.size
+	stats.Oversize = l.oversize
+	l.mu.Unlock()
+
+	l.millMu.Lock()
+	stats.Backups = l.millStats.Backups
+	stats.BackupBytes = l.millStats.BackupBytes
+	stats.LastMillDuration = l.millStats.LastMillDuration
+	stats.LastMillError = l.millStats.LastMillError
+	l.millMu.Unlock()
+	return stats
+}
+
+// millRunStats runs the mill once and records its duration, error and the
+// resulting backup files.
+func (l *Logger) millRunStats() {
+	start := l.now()
+	err := l.millRunOnce()
+	duration := l.now().Sub(start)
+
+	var backups int
+	var backupBytes int64
+	files, errFiles := l.oldLogFiles()
+	if err == nil {
+		err = errFiles
+	}
+	for _, f := range files {
+		backups++
+		backupBytes += f.Size()
+	}
+
+	l.millMu.Lock()
+	defer l.millMu.Unlock()
+	l.millStats.Backups = backups
+	l.millStats.BackupBytes = backupBytes
+	l.millStats.LastMillDuration = duration
+	l.millStats.LastMillError = ""
+	if err != nil {
+		l.millStats.LastMillError = err.Error()
+	}
+}
@@ -0,0 +1,110 @@
+package lumberjack
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// throttleChunk 限速读取时每次读取的最大字节数
+const throttleChunk = 32 * 1024
+
+// rateLimiter 限制mill每秒处理的字节数，被所有worker共享
+//
+// nil表示不限速。
+type rateLimiter struct {
+	mu    sync.Mutex
+	rate  int64     // 每秒字节数
+	next  time.Time // 下一次可以处理的时间
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// newRateLimiter 创建限速器，rate不大于0时返回nil
+//
+// now和sleep为时间来源，与Logger的Clock保持一致。
+func newRateLimiter(rate int64, now func() time.Time, sleep func(time.Duration)) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: rate, now: now, sleep: sleep}
+}
+
+// wait 为n个字节预留处理时间，必要时等待
+func (r *rateLimiter) wait(n int64) {
+	if r == nil || n <= 0 {
+		return
+	}
+	r.mu.Lock()
+	now := r.now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	delay := r.next.Sub(now)
+	r.next = r.next.Add(time.Duration(float64(n) / float64(r.rate) * float64(time.Second)))
+	r.mu.Unlock()
+
+	if delay > 0 {
+		r.sleep(delay)
+	}
+}
+
+// reader 返回按照限速读取src的Reader
+func (r *rateLimiter) reader(src io.Reader) io.Reader {
+	if r == nil {
+		return src
+	}
+	return &throttledReader{r: src, limiter: r}
+}
+
+type throttledReader struct {
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	n, err := t.r.Read(p)
+	t.limiter.wait(int64(n))
+	return n, err
+}
+
+// runTasks 使用最多concurrency个goroutine执行tasks，返回第一个错误
+func runTasks(tasks []func() error, concurrency int) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > len(tasks) {
+		concurrency = len(tasks)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	ch := make(chan func() error)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range ch {
+				if err := task(); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, task := range tasks {
+		ch <- task
+	}
+	close(ch)
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,11 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package lumberjack
+
+import "syscall"
+
+// isCrossDevice reports whether err means a rename crossed filesystems.
+func isCrossDevice(err error) bool {
+	return err == syscall.EXDEV
+}
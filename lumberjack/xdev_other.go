@@ -0,0 +1,11 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package lumberjack
+
+// isCrossDevice reports whether err means a rename crossed filesystems.
+//
+// On these platforms a failed rename is always retried as a copy.
+func isCrossDevice(err error) bool {
+	return err != nil
+}
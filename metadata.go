@@ -0,0 +1,81 @@
+package zdpgo_log
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/zhangdapeng520/zdpgo_log/core"
+)
+
+// MetadataConfig selects process and environment metadata added as fields to
+// every entry, so that services don't have to add them by hand with Fields.
+type MetadataConfig struct {
+	// Hostname adds the "hostname" field.
+	Hostname bool `json:"hostname" yaml:"hostname"`
+	// PID adds the "pid" field.
+	PID bool `json:"pid" yaml:"pid"`
+	// GoVersion adds the "go_version" field, such as "go1.17.13".
+	GoVersion bool `json:"goVersion" yaml:"goVersion"`
+	// Binary adds the "binary" field, the base name of the executable.
+	Binary bool `json:"binary" yaml:"binary"`
+	// Version adds the "version" field, the version of the main module as
+	// recorded by debug.ReadBuildInfo. Binaries built from a work tree report
+	// "(devel)".
+	Version bool `json:"version" yaml:"version"`
+	// Env lists environment variables, such as POD_NAME, NAMESPACE or REGION,
+	// added under their lower-cased names. Unset variables are skipped.
+	Env []string `json:"env" yaml:"env"`
+	// GoroutineID adds the "goroutine" field, the ID of the logging
+	// goroutine. Unlike the other fields it's computed for every entry; see
+	// core.NewGoroutineIDCore.
+	GoroutineID bool `json:"goroutineID" yaml:"goroutineID"`
+}
+
+// fields returns the static metadata fields.
+func (mc MetadataConfig) fields() []Field {
+	var fs []Field
+	if mc.Hostname {
+		if hostname, err := os.Hostname(); err == nil {
+			fs = append(fs, String("hostname", hostname))
+		}
+	}
+	if mc.PID {
+		fs = append(fs, Int("pid", os.Getpid()))
+	}
+	if mc.GoVersion {
+		fs = append(fs, String("go_version", runtime.Version()))
+	}
+	if mc.Binary {
+		if exe, err := os.Executable(); err == nil {
+			fs = append(fs, String("binary", filepath.Base(exe)))
+		} else if len(os.Args) > 0 {
+			fs = append(fs, String("binary", filepath.Base(os.Args[0])))
+		}
+	}
+	if mc.Version {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			fs = append(fs, String("version", info.Main.Version))
+		}
+	}
+	for _, name := range mc.Env {
+		if v, ok := os.LookupEnv(name); ok {
+			fs = append(fs, String(strings.ToLower(name), v))
+		}
+	}
+	return fs
+}
+
+// wrap adds the metadata to c. It must be applied after any asynchronous
+// Core, so that the goroutine ID is the caller's.
+func (mc MetadataConfig) wrap(c core.Core) core.Core {
+	if mc.GoroutineID {
+		c = core.NewGoroutineIDCore(c, "goroutine")
+	}
+	if fs := mc.fields(); len(fs) > 0 {
+		c = c.With(fs)
+	}
+	return c
+}
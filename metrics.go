@@ -0,0 +1,74 @@
+package zdpgo_log
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/zhangdapeng520/zdpgo_log/core"
+)
+
+// NewMetricsHandler returns an http.Handler that reports m in the Prometheus
+// text exposition format, for example:
+//
+//   # HELP zdpgo_log_entries_total Log entries written, by level and logger.
+//   # TYPE zdpgo_log_entries_total counter
+//   zdpgo_log_entries_total{level="error",logger="db"} 3
+//
+// It can be mounted next to an AtomicLevel:
+//
+//   mux.Handle("/log/level", cfg.Level)
+//   mux.Handle("/log/metrics", zdpgo_log.NewMetricsHandler(metrics))
+func NewMetricsHandler(m *core.Metrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Only GET and HEAD are supported.", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		writeMetrics(bw, m.Snapshot())
+		bw.Flush()
+	})
+}
+
+// PublishMetrics publishes m under name with the expvar package, so that it
+// shows up in /debug/vars. Like expvar.Publish, it panics if name is already
+// in use.
+func PublishMetrics(name string, m *core.Metrics) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return m.Snapshot()
+	}))
+}
+
+func writeMetrics(w *bufio.Writer, s core.MetricsSnapshot) {
+	writeMetricHeader(w, "zdpgo_log_entries_total", "Log entries written, by level and logger.")
+	for _, lm := range s.Loggers {
+		fmt.Fprintf(w, "zdpgo_log_entries_total{level=%q,logger=\"%s\"} %d\n", lm.Level.String(), escapeLabel(lm.Logger), lm.Entries)
+	}
+	writeMetricHeader(w, "zdpgo_log_bytes_total", "Encoded bytes written, by level and logger.")
+	for _, lm := range s.Loggers {
+		fmt.Fprintf(w, "zdpgo_log_bytes_total{level=%q,logger=\"%s\"} %d\n", lm.Level.String(), escapeLabel(lm.Logger), lm.Bytes)
+	}
+
+	writeMetricHeader(w, "zdpgo_log_dropped_total", "Log entries dropped.")
+	fmt.Fprintf(w, "zdpgo_log_dropped_total %d\n", s.Dropped)
+	writeMetricHeader(w, "zdpgo_log_sampled_total", "Log entries kept by the sampler.")
+	fmt.Fprintf(w, "zdpgo_log_sampled_total %d\n", s.Sampled)
+	writeMetricHeader(w, "zdpgo_log_write_errors_total", "Log writes that failed.")
+	fmt.Fprintf(w, "zdpgo_log_write_errors_total %d\n", s.Errors)
+}
+
+func writeMetricHeader(w *bufio.Writer, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+}
+
+var _labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes a label value as the exposition format requires.
+func escapeLabel(v string) string {
+	return _labelEscaper.Replace(v)
+}
@@ -0,0 +1,56 @@
+package observer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_log/core"
+)
+
+func TestObserver(t *testing.T) {
+	c, logs := New(core.InfoLevel)
+	c = c.With([]core.Field{{Key: "request_id", Type: core.StringType, String: "r1"}})
+
+	write := func(lvl core.Level, name, msg string, fields ...core.Field) {
+		if ce := c.Check(core.Entry{Level: lvl, LoggerName: name, Message: msg, Time: time.Now()}, nil); ce != nil {
+			ce.Write(fields...)
+		}
+	}
+	write(core.DebugLevel, "db", "not recorded")
+	write(core.InfoLevel, "db", "connected")
+	write(core.WarnLevel, "api", "slow request", core.Field{Key: "path", Type: core.StringType, String: "/users"})
+	write(core.ErrorLevel, "api", "request failed")
+
+	if n := logs.Len(); n != 3 {
+		t.Fatalf("expected 3 entries, got %d", n)
+	}
+	if n := logs.FilterLevelExact(core.WarnLevel).Len(); n != 1 {
+		t.Errorf("expected 1 warning, got %d", n)
+	}
+	if n := logs.FilterMessageSnippet("request").Len(); n != 2 {
+		t.Errorf("expected 2 entries about requests, got %d", n)
+	}
+	if n := logs.FilterLoggerName("db").FilterMessage("connected").Len(); n != 1 {
+		t.Errorf("expected 1 connection entry, got %d", n)
+	}
+	path := core.Field{Key: "path", Type: core.StringType, String: "/users"}
+	if n := logs.FilterField(path).Len(); n != 1 {
+		t.Errorf("expected 1 entry with %v, got %d", path.Key, n)
+	}
+	if n := logs.FilterFieldKey("request_id").Len(); n != 3 {
+		t.Errorf("expected context fields on every entry, got %d", n)
+	}
+
+	for _, e := range logs.AllUntimed() {
+		if !e.Time.IsZero() {
+			t.Errorf("expected untimed entries, got %v", e.Time)
+		}
+	}
+	if m := logs.All()[1].ContextMap(); m["path"] != "/users" || m["request_id"] != "r1" {
+		t.Errorf("unexpected context map %v", m)
+	}
+
+	if all := logs.TakeAll(); len(all) != 3 || logs.Len() != 0 {
+		t.Errorf("expected TakeAll to return 3 entries and empty the logs, got %d and %d", len(all), logs.Len())
+	}
+}
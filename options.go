@@ -31,14 +31,27 @@ func WrapCore(f func(core.Core) core.Core) Option {
 //
 // Hooks are useful for simple side effects, like capturing metrics for the
 // number of emitted logs. More complex side effects, including anything that
-// requires access to the Entry's structured fields, should be implemented as
-// a core.Core instead. See core.RegisterHooks for details.
+// requires access to the Entry's structured fields, should use FieldHook or
+// be implemented as a core.Core instead. See core.RegisterHooks for details.
 func Hooks(hooks ...func(core.Entry) error) Option {
 	return optionFunc(func(log *Logger) {
 		log.core = core.RegisterHooks(log.core, hooks...)
 	})
 }
 
+// FieldHook registers a function which will be called each time the Logger
+// writes out an Entry, along with the Entry's fields in map form. The hook
+// can be restricted to some levels and run asynchronously with
+// core.HookLevel and core.HookAsync; see core.RegisterFieldHook for details.
+//
+// An asynchronous hook runs on a goroutine that lives as long as the
+// process. Use core.RegisterFieldHook directly to be able to stop it.
+func FieldHook(hook core.FieldHook, opts ...core.HookOption) Option {
+	return optionFunc(func(log *Logger) {
+		log.core, _ = core.RegisterFieldHook(log.core, hook, opts...)
+	})
+}
+
 // Fields adds fields to the Logger.
 func Fields(fs ...Field) Option {
 	return optionFunc(func(log *Logger) {
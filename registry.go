@@ -0,0 +1,123 @@
+package zdpgo_log
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/zhangdapeng520/zdpgo_log/lumberjack"
+)
+
+// sharedWriter 被多个日志对象共享的日志文件写入对象
+type sharedWriter struct {
+	writer   *lumberjack.Logger
+	settings writerSettings
+	refs     int
+}
+
+// writerSettings 创建写入对象时使用的配置，用于发现同一文件的配置冲突
+type writerSettings struct {
+	MaxSize, MaxBackups, MaxAge, MaxLines uint
+	Compress                              bool
+	Oversize                              string
+
+	RotateOnStartup, WriteHeader bool
+	AppVersion, BackupDir        string
+	FsyncPolicy, FsyncInterval   string
+	FsyncBytes                   uint
+	FileMode, DirMode            string
+	FileOwner, FileGroup         string
+
+	MillConcurrency, MillBytesPerSecond, CompressAfter uint
+	Manifest                                           bool
+}
+
+func newWriterSettings(c LogConfig) writerSettings {
+	return writerSettings{
+		MaxSize:            c.MaxSize,
+		MaxBackups:         c.MaxBackups,
+		MaxAge:             c.MaxAge,
+		MaxLines:           c.MaxLines,
+		Compress:           c.Compress,
+		Oversize:           c.Oversize,
+		RotateOnStartup:    c.RotateOnStartup,
+		WriteHeader:        c.WriteHeader,
+		AppVersion:         c.AppVersion,
+		BackupDir:          c.BackupDir,
+		FsyncPolicy:        c.FsyncPolicy,
+		FsyncInterval:      c.FsyncInterval,
+		FsyncBytes:         c.FsyncBytes,
+		FileMode:           c.FileMode,
+		DirMode:            c.DirMode,
+		FileOwner:          c.FileOwner,
+		FileGroup:          c.FileGroup,
+		MillConcurrency:    c.MillConcurrency,
+		MillBytesPerSecond: c.MillBytesPerSecond,
+		CompressAfter:      c.CompressAfter,
+		Manifest:           c.Manifest,
+	}
+}
+
+// diff 列出与other不同的配置项，格式为"名称: 当前值 != other的值"
+func (s writerSettings) diff(other writerSettings) string {
+	var diffs []string
+	v, o := reflect.ValueOf(s), reflect.ValueOf(other)
+	for i := 0; i < v.NumField(); i++ {
+		if a, b := v.Field(i).Interface(), o.Field(i).Interface(); a != b {
+			diffs = append(diffs, fmt.Sprintf("%s: %v != %v", v.Type().Field(i).Name, a, b))
+		}
+	}
+	return strings.Join(diffs, ", ")
+}
+
+// writerRegistry 按日志文件绝对路径登记的写入对象
+//
+// 指向同一文件的日志对象共享同一个lumberjack.Logger，避免各自统计文件大小并同时备份同一个文件。
+var writerRegistry = struct {
+	sync.Mutex
+	writers map[string]*sharedWriter
+}{writers: make(map[string]*sharedWriter)}
+
+// acquireLogWriter 获取日志文件的写入对象，返回写入对象和它在注册表中的key
+//
+// 同一文件已经有写入对象时直接复用，此时以第一次创建时的配置为准，配置不同时输出到标准错误。
+func acquireLogWriter(config LogConfig) (*lumberjack.Logger, string) {
+	config = getDefaultConfig(config)
+	key, err := filepath.Abs(config.LogFilePath)
+	if err != nil {
+		key = filepath.Clean(config.LogFilePath)
+	}
+
+	writerRegistry.Lock()
+	defer writerRegistry.Unlock()
+	settings := newWriterSettings(config)
+	if w, ok := writerRegistry.writers[key]; ok {
+		if w.settings != settings {
+			fmt.Fprintf(os.Stderr, "log file %s is already open with different settings, keeping the first ones: %s\n", key, w.settings.diff(settings))
+		}
+		w.refs++
+		return w.writer, key
+	}
+	w := &sharedWriter{writer: getLogWriter(config), settings: settings, refs: 1}
+	writerRegistry.writers[key] = w
+	return w.writer, key
+}
+
+// releaseLogWriter 释放写入对象，最后一个引用释放时关闭日志文件
+func releaseLogWriter(key string) error {
+	writerRegistry.Lock()
+	defer writerRegistry.Unlock()
+	w, ok := writerRegistry.writers[key]
+	if !ok {
+		return nil
+	}
+	w.refs--
+	if w.refs > 0 {
+		return nil
+	}
+	delete(writerRegistry.writers, key)
+	return w.writer.Close()
+}
@@ -0,0 +1,174 @@
+// Package zdpgotest provides loggers that write through a testing.T, so that
+// log output only shows up for failing tests, next to the right subtest.
+package zdpgotest
+
+import (
+	"bytes"
+
+	zdpgo_log "github.com/zhangdapeng520/zdpgo_log"
+	"github.com/zhangdapeng520/zdpgo_log/core"
+)
+
+// TestingT is a subset of the API provided by all *testing.T and
+// *testing.B objects.
+type TestingT interface {
+	// Logs the given message without failing the test.
+	Logf(string, ...interface{})
+
+	// Logs the given message and marks the test as failed.
+	Errorf(string, ...interface{})
+
+	// Marks the test as failed.
+	Fail()
+
+	// Returns true if the test has been marked as failed.
+	Failed() bool
+
+	// Returns the name of the test.
+	Name() string
+
+	// Marks the test as failed and stops execution of that test.
+	FailNow()
+}
+
+// Note: We currently rely on Logf, and on Errorf with FailOnError. The other
+// methods are included in anticipation of future need since we can't extend
+// the interface without a breaking change.
+
+// LoggerOption configures the test logger built by NewLogger.
+type LoggerOption interface {
+	applyLoggerOption(*loggerOptions)
+}
+
+type loggerOptions struct {
+	Level       core.LevelEnabler
+	failOnError bool
+	zapOptions  []zdpgo_log.Option
+}
+
+type loggerOptionFunc func(*loggerOptions)
+
+func (f loggerOptionFunc) applyLoggerOption(opts *loggerOptions) {
+	f(opts)
+}
+
+// Level controls which messages are logged by a test Logger built by
+// NewLogger. Defaults to DebugLevel.
+func Level(enab core.LevelEnabler) LoggerOption {
+	return loggerOptionFunc(func(opts *loggerOptions) {
+		opts.Level = enab
+	})
+}
+
+// WrapOptions adds Logger options to the test Logger built by NewLogger.
+func WrapOptions(zapOpts ...zdpgo_log.Option) LoggerOption {
+	return loggerOptionFunc(func(opts *loggerOptions) {
+		opts.zapOptions = append(opts.zapOptions, zapOpts...)
+	})
+}
+
+// FailOnError marks the test as failed when an entry at ErrorLevel or above
+// is logged, so that unexpected errors don't go unnoticed.
+func FailOnError() LoggerOption {
+	return loggerOptionFunc(func(opts *loggerOptions) {
+		opts.failOnError = true
+	})
+}
+
+// NewLogger builds a new Logger that logs all messages to the given
+// testing.TB.
+//
+//   logger := zdpgotest.NewLogger(t)
+//
+// Use this with a *testing.T or *testing.B to get logs which get printed only
+// if a test fails or if you ran go test -v.
+//
+// The returned logger defaults to logging debug level messages and above.
+// This may be changed by passing a zdpgotest.Level during construction.
+//
+//   logger := zdpgotest.NewLogger(t, zdpgotest.Level(zdpgo_log.WarnLevel))
+//
+// You may also pass Logger options to the returned Logger with
+// zdpgotest.WrapOptions.
+//
+//   logger := zdpgotest.NewLogger(t, zdpgotest.WrapOptions(zdpgo_log.AddCaller()))
+func NewLogger(t TestingT, opts ...LoggerOption) *zdpgo_log.Logger {
+	cfg := loggerOptions{
+		Level: core.DebugLevel,
+	}
+	for _, o := range opts {
+		o.applyLoggerOption(&cfg)
+	}
+
+	writer := newTestingWriter(t)
+	zapOptions := []zdpgo_log.Option{
+		// Send zap errors to the same writer and mark the test as failed if
+		// that happens.
+		zdpgo_log.ErrorOutput(writer.WithMarkFailed(true)),
+	}
+	if cfg.failOnError {
+		zapOptions = append(zapOptions, zdpgo_log.Hooks(func(ent core.Entry) error {
+			if ent.Level >= core.ErrorLevel {
+				t.Errorf("unexpected %v entry logged: %s", ent.Level.CapitalString(), ent.Message)
+			}
+			return nil
+		}))
+	}
+	zapOptions = append(zapOptions, cfg.zapOptions...)
+
+	return zdpgo_log.New(
+		core.NewCore(
+			core.NewConsoleEncoder(zdpgo_log.NewDevelopmentEncoderConfig()),
+			writer,
+			cfg.Level,
+		),
+		zapOptions...,
+	)
+}
+
+// NewLog is like NewLogger, but returns a *zdpgo_log.Log for code that takes
+// one.
+//
+//   log := zdpgotest.NewLog(t, zdpgotest.FailOnError())
+func NewLog(t TestingT, opts ...LoggerOption) *zdpgo_log.Log {
+	return zdpgo_log.NewWithLogger(NewLogger(t, opts...))
+}
+
+// testingWriter is a WriteSyncer that writes to the given testing.TB.
+type testingWriter struct {
+	t TestingT
+
+	// If true, the test will be marked as failed if this testingWriter is
+	// ever used.
+	markFailed bool
+}
+
+func newTestingWriter(t TestingT) testingWriter {
+	return testingWriter{t: t}
+}
+
+// WithMarkFailed returns a copy of this testingWriter with markFailed set to
+// the provided value.
+func (w testingWriter) WithMarkFailed(v bool) testingWriter {
+	w.markFailed = v
+	return w
+}
+
+func (w testingWriter) Write(p []byte) (n int, err error) {
+	n = len(p)
+
+	// Strip trailing newline because t.Log always adds one.
+	p = bytes.TrimRight(p, "\n")
+
+	// Note: t.Log is safe for concurrent use.
+	w.t.Logf("%s", p)
+	if w.markFailed {
+		w.t.Fail()
+	}
+
+	return n, nil
+}
+
+func (w testingWriter) Sync() error {
+	return nil
+}
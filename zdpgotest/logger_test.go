@@ -0,0 +1,77 @@
+package zdpgotest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	zdpgo_log "github.com/zhangdapeng520/zdpgo_log"
+)
+
+// testLogSpy is a TestingT that records what it's given.
+type testLogSpy struct {
+	testing.TB
+
+	failed   bool
+	Messages []string
+}
+
+func newTestLogSpy(t testing.TB) *testLogSpy {
+	return &testLogSpy{TB: t}
+}
+
+func (t *testLogSpy) Fail() {
+	t.failed = true
+}
+
+func (t *testLogSpy) Failed() bool {
+	return t.failed
+}
+
+func (t *testLogSpy) FailNow() {
+	t.Fail()
+	t.TB.FailNow()
+}
+
+func (t *testLogSpy) Logf(format string, args ...interface{}) {
+	t.Messages = append(t.Messages, fmt.Sprintf(format, args...))
+}
+
+func (t *testLogSpy) Errorf(format string, args ...interface{}) {
+	t.Logf(format, args...)
+	t.Fail()
+}
+
+func TestLogger(t *testing.T) {
+	ts := newTestLogSpy(t)
+	log := NewLogger(ts, Level(zdpgo_log.InfoLevel))
+	log.Debug("hidden")
+	log.Info("received work order")
+	log.Error("work failed", zdpgo_log.String("reason", "timeout"))
+
+	if len(ts.Messages) != 2 {
+		t.Fatalf("expected 2 messages, got %q", ts.Messages)
+	}
+	if !strings.Contains(ts.Messages[0], "INFO") || !strings.Contains(ts.Messages[0], "received work order") {
+		t.Errorf("unexpected message %q", ts.Messages[0])
+	}
+	if !strings.Contains(ts.Messages[1], `{"reason": "timeout"}`) {
+		t.Errorf("expected fields in %q", ts.Messages[1])
+	}
+	if ts.Failed() {
+		t.Error("logging an error shouldn't fail the test by default")
+	}
+}
+
+func TestLogFailOnError(t *testing.T) {
+	ts := newTestLogSpy(t)
+	log := NewLog(ts, FailOnError())
+	log.Warning("disk almost full", "free", "1%")
+	if ts.Failed() {
+		t.Fatal("logging a warning shouldn't fail the test")
+	}
+	log.Error("disk full")
+	if !ts.Failed() {
+		t.Error("expected logging an error to fail the test")
+	}
+}